@@ -0,0 +1,294 @@
+package main
+
+
+import (
+    "context"
+    "encoding/json"
+    "fmt"
+    "net/http"
+    "net/url"
+    "strconv"
+    "strings"
+    "sync"
+)
+
+// AnalyzeRequest asks for the analysis of a position, e.g.
+//   {"engine": "stockfish", "fen": "...", "moves": ["e2e4"], "depth": 20, "multipv": 3}
+type AnalyzeRequest struct {
+    Engine string `json:"engine,omitempty"` // the default engine if empty
+    SetPositionPayload
+    AnalyzePayload
+}
+
+// AnalyzeResponse is the result of a finished search
+type AnalyzeResponse struct {
+    Engine string `json:"engine"`
+    BestMove string `json:"bestMove"`
+    Ponder string `json:"ponder,omitempty"`
+    AnalysisUpdatePayload // the lines of the last update
+}
+
+// MAX_HTTP_ENGINES is how many engines the http requests may run at the same time
+const MAX_HTTP_ENGINES = 4
+
+// engineSlots limits the engines of the http requests, a request takes a slot or is turned away
+type engineSlots chan struct{}
+
+func newEngineSlots(n int) engineSlots { return make(engineSlots, n) }
+
+func (slots engineSlots) take() error {
+    select {
+    case slots <- struct{}{}:
+        return nil
+    default:
+        return &analysisError{http.StatusServiceUnavailable, fmt.Sprintf("the server runs %d analyses already, try again later", cap(slots))}
+    }
+}
+
+func (slots engineSlots) free() { <-slots }
+
+// analysisError is an error with the http status it is answered with
+type analysisError struct {
+    status int
+    message string
+}
+
+func (e *analysisError) Error() string { return e.message }
+
+// validate checks the position before an engine is started
+func (req *AnalyzeRequest) validate() error {
+    position := Position{Fen: req.Fen, Moves: req.Moves}
+    if _, err := position.Board(); err != nil {
+        return &analysisError{http.StatusBadRequest, err.Error()}
+    }
+    return nil
+}
+
+// callWire is the wire of an http request, the handler reads and writes the messages of the protocol
+type callWire struct {
+    output chan string
+    input chan string
+    done chan struct{}
+    doneOnce sync.Once
+}
+
+func newCallWire() *callWire {
+    // the messages of the request are taken even while the session waits for the handler to read
+    return &callWire{output: make(chan string), input: make(chan string, 4), done: make(chan struct{})}
+}
+
+func (w *callWire) Output() chan<- string { return w.output }
+func (w *callWire) Input() <-chan string { return w.input }
+func (w *callWire) Done() <-chan struct{} { return w.done }
+func (w *callWire) Start(ctx context.Context) {}
+func (w *callWire) Terminate() { w.doneOnce.Do(func() { close(w.done) }) }
+
+// analyze runs a search on a new engine the same way a websocket session does.
+// Every analysis update and at last the best move are passed to update.
+func analyze(ctx context.Context, config *EngineConfig, req *AnalyzeRequest, update func(*Envelope)) error {
+    position, err := NewEnvelope(MSG_SET_POSITION, "", req.SetPositionPayload)
+    if err != nil {
+        return err
+    }
+    search, err := NewEnvelope(MSG_ANALYZE, "", req.AnalyzePayload)
+    if err != nil {
+        return err
+    }
+
+    w := newCallWire()
+    ended := make(chan struct{})
+    go func() {
+        defer close(ended)
+        multiPlug(ctx, []*Engine{NewEngine(config)}, w)
+    }()
+    defer func() {
+        w.Terminate()
+        <-ended
+    }()
+
+    ready := false
+    for {
+        var msg string
+        select {
+        case msg = <-w.output:
+        case <-ended:
+            return &analysisError{http.StatusBadGateway, fmt.Sprintf("engine %s has quit", config.Name)}
+        case <-ctx.Done():
+            return ctx.Err()
+        }
+        env, err := DecodeEnvelope(msg)
+        if err != nil {
+            return err
+        }
+        switch env.Type {
+        case MSG_UCI:
+            payload := UciPayload{}
+            json.Unmarshal(env.Payload, &payload)
+            if payload.Line == "readyok" && !ready {
+                // a restarted engine gets the position and the search again from its session
+                ready = true
+                w.input <- position.Encode()
+                w.input <- search.Encode()
+            }
+        case MSG_ERROR:
+            payload := ErrorPayload{}
+            json.Unmarshal(env.Payload, &payload)
+            return &analysisError{http.StatusBadRequest, payload.Message}
+        case MSG_ENGINE_ERROR:
+            payload := EngineErrorPayload{}
+            json.Unmarshal(env.Payload, &payload)
+            if payload.Restart == 0 {
+                return &analysisError{http.StatusBadGateway, payload.Message}
+            }
+        case MSG_ANALYSIS_UPDATE:
+            update(env)
+        case MSG_BEST_MOVE:
+            update(env)
+            return nil
+        }
+    }
+}
+
+// analyzeHandler answers POST /analyze when the search has finished, the search needs a limit
+func analyzeHandler(registry *EngineRegistry, slots engineSlots) http.HandlerFunc {
+    return func(w http.ResponseWriter, r *http.Request) {
+        if r.Method != http.MethodPost {
+            http.Error(w, "POST a position to analyze", http.StatusMethodNotAllowed)
+            return
+        }
+        req := &AnalyzeRequest{}
+        if err := json.NewDecoder(r.Body).Decode(req); err != nil {
+            writeAnalysisError(w, &analysisError{http.StatusBadRequest, "invalid request: " + err.Error()})
+            return
+        }
+        limits := req.AnalyzePayload
+        if limits.Depth <= 0 && limits.Nodes <= 0 && limits.MoveTime <= 0 && limits.Mate <= 0 {
+            writeAnalysisError(w, &analysisError{http.StatusBadRequest, "the search needs a limit: depth, nodes, movetime or mate"})
+            return
+        }
+        config, err := requestEngine(registry, req)
+        if err != nil {
+            writeAnalysisError(w, err)
+            return
+        }
+        if err := slots.take(); err != nil {
+            writeAnalysisError(w, err)
+            return
+        }
+        defer slots.free()
+
+        response := &AnalyzeResponse{Engine: config.Name, AnalysisUpdatePayload: AnalysisUpdatePayload{Lines: []LinePayload{}}}
+        err = analyze(r.Context(), config, req, func(env *Envelope) {
+            if env.Type == MSG_BEST_MOVE {
+                bestMove := BestMovePayload{}
+                json.Unmarshal(env.Payload, &bestMove)
+                response.BestMove, response.Ponder = bestMove.Move, bestMove.Ponder
+            } else {
+                // a fresh payload, the fields an update leaves out don't stay from an earlier one
+                payload := AnalysisUpdatePayload{}
+                json.Unmarshal(env.Payload, &payload)
+                response.AnalysisUpdatePayload = payload
+            }
+        })
+        if err != nil {
+            writeAnalysisError(w, err)
+            return
+        }
+        w.Header().Set("Content-Type", "application/json")
+        json.NewEncoder(w).Encode(response)
+    }
+}
+
+// analyzeStreamHandler streams the analysis of GET /analyze/stream as server-sent events, e.g.
+//   /analyze/stream?fen=...&moves=e2e4+e7e5&depth=30&multipv=2
+// Every update is an event "analysisUpdate", the stream ends with the event "bestMove".
+// Without a limit the search runs until the client goes away.
+func analyzeStreamHandler(registry *EngineRegistry, slots engineSlots) http.HandlerFunc {
+    return func(w http.ResponseWriter, r *http.Request) {
+        flusher, ok := w.(http.Flusher)
+        if !ok {
+            http.Error(w, "streaming is not supported", http.StatusInternalServerError)
+            return
+        }
+        req, err := parseAnalyzeQuery(r.URL.Query())
+        if err != nil {
+            writeAnalysisError(w, &analysisError{http.StatusBadRequest, err.Error()})
+            return
+        }
+        config, err := requestEngine(registry, req)
+        if err != nil {
+            writeAnalysisError(w, err)
+            return
+        }
+        if err := slots.take(); err != nil {
+            writeAnalysisError(w, err)
+            return
+        }
+        defer slots.free()
+
+        w.Header().Set("Content-Type", "text/event-stream")
+        w.Header().Set("Cache-Control", "no-cache")
+        w.WriteHeader(http.StatusOK)
+        flusher.Flush()
+        err = analyze(r.Context(), config, req, func(env *Envelope) {
+            fmt.Fprintf(w, "event: %s\ndata: %s\n\n", env.Type, env.Payload)
+            flusher.Flush()
+        })
+        if err != nil && r.Context().Err() == nil {
+            payload, _ := json.Marshal(ErrorPayload{err.Error()})
+            fmt.Fprintf(w, "event: %s\ndata: %s\n\n", MSG_ERROR, payload)
+            flusher.Flush()
+        }
+    }
+}
+
+// requestEngine checks the request and finds its engine
+func requestEngine(registry *EngineRegistry, req *AnalyzeRequest) (*EngineConfig, error) {
+    if err := req.validate(); err != nil {
+        return nil, err
+    }
+    config, err := registry.Engine(req.Engine)
+    if err != nil {
+        return nil, &analysisError{http.StatusNotFound, err.Error()}
+    }
+    return config, nil
+}
+
+func writeAnalysisError(w http.ResponseWriter, err error) {
+    status := http.StatusInternalServerError
+    if e, ok := err.(*analysisError); ok {
+        status = e.status
+    }
+    w.Header().Set("Content-Type", "application/json")
+    w.WriteHeader(status)
+    json.NewEncoder(w).Encode(ErrorPayload{err.Error()})
+}
+
+// parseAnalyzeQuery reads a request from the parameters engine, fen, moves, depth, nodes, movetime, mate and multipv
+func parseAnalyzeQuery(query url.Values) (*AnalyzeRequest, error) {
+    req := &AnalyzeRequest{Engine: query.Get("engine")}
+    req.Fen = query.Get("fen")
+    req.Moves = strings.Fields(query.Get("moves"))
+    numbers := []struct {
+        name string
+        set func(int64)
+    }{
+        {"depth", func(n int64) { req.Depth = int(n) }},
+        {"nodes", func(n int64) { req.Nodes = n }},
+        {"movetime", func(n int64) { req.MoveTime = n }},
+        {"mate", func(n int64) { req.Mate = int(n) }},
+        {"multipv", func(n int64) { req.MultiPV = int(n) }},
+    }
+    for _, number := range numbers {
+        value := query.Get(number.name)
+        if value == "" {
+            continue
+        }
+        n, err := strconv.ParseInt(value, 10, 64)
+        if err != nil || n < 0 {
+            return nil, fmt.Errorf("%s must be a number, got '%s'", number.name, value)
+        }
+        number.set(n)
+    }
+    return req, nil
+}
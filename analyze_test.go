@@ -0,0 +1,109 @@
+package main
+
+
+import (
+    "encoding/json"
+    "io/ioutil"
+    "net/http"
+    "net/http/httptest"
+    "strings"
+    "testing"
+    "github.com/stretchr/testify/assert"
+)
+
+func postAnalyze(t *testing.T, registry *EngineRegistry, body string) (int, string) {
+    return postAnalyzeSlots(t, registry, newEngineSlots(MAX_HTTP_ENGINES), body)
+}
+
+func postAnalyzeSlots(t *testing.T, registry *EngineRegistry, slots engineSlots, body string) (int, string) {
+    server := httptest.NewServer(analyzeHandler(registry, slots))
+    defer server.Close()
+    response, err := http.Post(server.URL, "application/json", strings.NewReader(body))
+    assert.Nil(t, err)
+    defer response.Body.Close()
+    bytes, err := ioutil.ReadAll(response.Body)
+    assert.Nil(t, err)
+    return response.StatusCode, string(bytes)
+}
+
+func TestAnalyzeHandler_01(t *testing.T) {
+    registry := &EngineRegistry{Engines: []*EngineConfig{fakeEngineConfig(t, "fake", "25")}}
+    status, body := postAnalyze(t, registry, `{"moves": ["d2d4", "d7d5"], "depth": 1}`)
+    assert.Equal(t, http.StatusOK, status)
+    response := AnalyzeResponse{}
+    assert.Nil(t, json.Unmarshal([]byte(body), &response))
+    assert.Equal(t, "fake", response.Engine)
+    assert.Equal(t, "e2e4", response.BestMove)
+    assert.Equal(t, 1, response.Depth)
+    assert.Equal(t, 1, len(response.Lines))
+    assert.Equal(t, 25, *response.Lines[0].Score.CP)
+    assert.Equal(t, "2.e4", response.Lines[0].SAN)
+}
+
+func TestAnalyzeHandler_error_01(t *testing.T) {
+    registry := &EngineRegistry{Engines: []*EngineConfig{fakeEngineConfig(t, "fake", "25")}}
+    status, body := postAnalyze(t, registry, `{"moves": ["e2e4"]}`)
+    assert.Equal(t, http.StatusBadRequest, status)
+    assert.Contains(t, body, "the search needs a limit")
+
+    status, body = postAnalyze(t, registry, `{"moves": ["e2e5"], "depth": 5}`)
+    assert.Equal(t, http.StatusBadRequest, status)
+    assert.Contains(t, body, "illegal move e2e5")
+
+    status, _ = postAnalyze(t, registry, `{"engine": "lc0", "depth": 5}`)
+    assert.Equal(t, http.StatusNotFound, status)
+}
+
+func TestAnalyzeHandler_error_02(t *testing.T) {
+    // the engine can't be started
+    policy := DEFAULT_RESTART_POLICY
+    DEFAULT_RESTART_POLICY = RestartPolicy{}
+    defer func() { DEFAULT_RESTART_POLICY = policy }()
+    registry := &EngineRegistry{Engines: []*EngineConfig{{Name: "missing", Path: "/does/not/exist/engine"}}}
+    status, body := postAnalyze(t, registry, `{"depth": 5}`)
+    assert.Equal(t, http.StatusBadGateway, status)
+    assert.Contains(t, body, "giving up")
+}
+
+func TestAnalyzeHandler_busy_01(t *testing.T) {
+    // no engine is started while all slots are taken
+    registry := &EngineRegistry{Engines: []*EngineConfig{fakeEngineConfig(t, "fake", "25")}}
+    slots := newEngineSlots(1)
+    assert.Nil(t, slots.take())
+    status, body := postAnalyzeSlots(t, registry, slots, `{"depth": 1}`)
+    assert.Equal(t, http.StatusServiceUnavailable, status)
+    assert.Contains(t, body, "runs 1 analyses already")
+
+    slots.free()
+    status, _ = postAnalyzeSlots(t, registry, slots, `{"depth": 1}`)
+    assert.Equal(t, http.StatusOK, status)
+    assert.Equal(t, 0, len(slots))
+}
+
+func TestAnalyzeStreamHandler_01(t *testing.T) {
+    registry := &EngineRegistry{Engines: []*EngineConfig{fakeEngineConfig(t, "fake", "-5")}}
+    server := httptest.NewServer(analyzeStreamHandler(registry, newEngineSlots(MAX_HTTP_ENGINES)))
+    defer server.Close()
+    response, err := http.Get(server.URL + "?fen=" + strings.Replace(STARTPOSITION, " ", "+", -1) + "&depth=1")
+    assert.Nil(t, err)
+    defer response.Body.Close()
+    assert.Equal(t, "text/event-stream", response.Header.Get("Content-Type"))
+    bytes, err := ioutil.ReadAll(response.Body)
+    assert.Nil(t, err)
+    assert.Equal(t,
+        "event: analysisUpdate\ndata: " +
+        `{"depth":1,"lines":[{"rank":1,"depth":1,"score":{"cp":-5},"pv":["e2e4"],"san":"1.e4"}]}` + "\n\n" +
+        "event: bestMove\ndata: " + `{"move":"e2e4"}` + "\n\n",
+        string(bytes))
+}
+
+func TestParseAnalyzeQuery_01(t *testing.T) {
+    query := map[string][]string{"moves": {"e2e4 e7e5"}, "depth": {"12"}, "multipv": {"3"}}
+    req, err := parseAnalyzeQuery(query)
+    assert.Nil(t, err)
+    assert.Equal(t, []string{"e2e4", "e7e5"}, req.Moves)
+    assert.Equal(t, AnalyzePayload{Depth: 12, MultiPV: 3}, req.AnalyzePayload)
+
+    _, err = parseAnalyzeQuery(map[string][]string{"depth": {"deep"}})
+    assert.EqualError(t, err, "depth must be a number, got 'deep'")
+}
@@ -0,0 +1,267 @@
+package main
+
+
+import (
+    "context"
+    "flag"
+    "fmt"
+    "io"
+    "log"
+    "os"
+    "time"
+)
+
+// the loss in centipawns from the view of the player that makes a move an inaccuracy, a mistake or a blunder
+const (
+    INACCURACY_CP = 50
+    MISTAKE_CP = 100
+    BLUNDER_CP = 300
+)
+
+// DEFAULT_ANNOTATE_DEPTH is the search depth when neither depth nor time are given
+const DEFAULT_ANNOTATE_DEPTH = 18
+
+// MATE_CP is the value of a mate in centipawns, a mate in n is worth a little less
+const MATE_CP = 10000
+
+// WINNING_CP caps the evaluations that are compared, a player who is winning anyway makes no mistake
+const WINNING_CP = 1000
+
+// Evaluation is what the engine thinks of a position
+type Evaluation struct {
+    Score *Score // from the point of view of the side to move
+    PV []string  // the best line in uci moves
+}
+
+// Evaluator analyzes a position, e.g. with an uci engine
+type Evaluator interface {
+    Evaluate(ctx context.Context, position Position) (*Evaluation, error)
+}
+
+// uciEvaluator runs a search with fixed limits for every position
+type uciEvaluator struct {
+    client *UciClient
+    limits Limits
+}
+
+func (e *uciEvaluator) Evaluate(ctx context.Context, position Position) (*Evaluation, error) {
+    search, err := e.client.Analyze(ctx, position, e.limits)
+    if err != nil {
+        return nil, err
+    }
+    evaluation := &Evaluation{}
+    for info := range search.Info {
+        if info.Score != nil && len(info.PV) > 0 && info.Rank() == 1 {
+            evaluation.Score, evaluation.PV = info.Score, info.PV
+        }
+    }
+    bestMove, err := search.Wait()
+    if err != nil {
+        return nil, err
+    }
+    if evaluation.Score == nil {
+        return nil, fmt.Errorf("annotate: the engine has no score for %s", position.Command())
+    }
+    if len(evaluation.PV) == 0 {
+        evaluation.PV = []string{bestMove.Move}
+    }
+    return evaluation, nil
+}
+
+// centipawns turns a score into centipawns, mates count as MATE_CP
+func centipawns(score *Score) int {
+    if !score.Mate {
+        return score.Value
+    }
+    if score.Value > 0 {
+        return MATE_CP - score.Value
+    }
+    return -MATE_CP - score.Value
+}
+
+func capWinning(cp int) int {
+    if cp > WINNING_CP {
+        return WINNING_CP
+    }
+    if cp < -WINNING_CP {
+        return -WINNING_CP
+    }
+    return cp
+}
+
+// judgement returns the NAG and the word for a loss of centipawns, 0 for a good move
+func judgement(loss int) (int, string) {
+    switch {
+    case loss >= BLUNDER_CP:
+        return 4, "Blunder"
+    case loss >= MISTAKE_CP:
+        return 2, "Mistake"
+    case loss >= INACCURACY_CP:
+        return 6, "Inaccuracy"
+    }
+    return 0, ""
+}
+
+// Annotate evaluates every position of the main line. The start and the moves get their evaluation,
+// inaccuracies, mistakes and blunders get ?!, ? and ?? and the better line of the engine as a variation.
+func Annotate(ctx context.Context, game *Game, evaluator Evaluator) error {
+    root := Position{}
+    if fenString := game.Root.Board.FEN(); fenString != STARTPOSITION {
+        root.Fen = fenString
+    }
+    nodes := append([]*Node{game.Root}, game.MainLine()...)
+
+    evaluations := []*Evaluation{}
+    for _, node := range nodes {
+        evaluation, err := evaluate(ctx, evaluator, node, root)
+        if err != nil {
+            return err
+        }
+        evaluations = append(evaluations, evaluation)
+        node.Eval = evaluation.Score.ForWhite(node.Board.WhiteToMove())
+    }
+
+    for i := 1; i < len(nodes); i++ {
+        node, before, after := nodes[i], evaluations[i - 1], evaluations[i]
+        // both from the view of the player who made the move
+        loss := capWinning(centipawns(before.Score)) - capWinning(-centipawns(after.Score))
+        nag, word := judgement(loss)
+        if nag == 0 || hasMoveAssessment(node) || len(before.PV) == 0 || before.PV[0] == node.Move.uciMove {
+            continue
+        }
+        node.NAGs = append(node.NAGs, nag)
+        variation := addVariation(node.Parent, before.PV)
+        if variation == nil {
+            continue
+        }
+        variation.Eval = before.Score.ForWhite(node.Parent.Board.WhiteToMove())
+        node.Comment = joinComments(node.Comment, fmt.Sprintf("%s. %s was best.", word, pgnMove(variation.Move)))
+    }
+    return nil
+}
+
+// evaluate asks the engine about the position of a node, a finished game needs no engine.
+// Only the endings of Status are finished, a draw that could be claimed is played on and evaluated.
+func evaluate(ctx context.Context, evaluator Evaluator, node *Node, root Position) (*Evaluation, error) {
+    switch node.Board.Status() {
+    case ONGOING:
+    case CHECKMATE:
+        return &Evaluation{Score: &Score{Mate: true, Value: 0}}, nil
+    default:
+        return &Evaluation{Score: &Score{}}, nil
+    }
+    moves := []string{}
+    for n := node; n.Move != nil; n = n.Parent {
+        moves = append([]string{n.Move.uciMove}, moves...)
+    }
+    return evaluator.Evaluate(ctx, Position{Fen: root.Fen, Moves: moves})
+}
+
+// hasMoveAssessment tells whether the move already has one of the NAGs $1 to $6
+func hasMoveAssessment(node *Node) bool {
+    for _, nag := range node.NAGs {
+        if nag >= 1 && nag <= 6 {
+            return true
+        }
+    }
+    return false
+}
+
+// addVariation plays the legal part of a line from a node, it returns the first move of the variation
+func addVariation(node *Node, uciMoves []string) *Node {
+    var first *Node
+    for _, uciMove := range legalPrefix(node.Board, uciMoves) {
+        for _, move := range node.Board.LegalMoves() {
+            if move.uciMove == uciMove {
+                node = node.AddChild(move)
+                break
+            }
+        }
+        if first == nil {
+            first = node
+        }
+    }
+    return first
+}
+
+// AnnotateMain annotates the games of a PGN file with an engine
+// usage: annotate [-engine name] [-depth n | -movetime ms] <input.pgn> [output.pgn]
+func AnnotateMain(args []string) {
+    flags := flag.NewFlagSet("annotate", flag.ExitOnError)
+    engineName, limits := engineFlags(flags)
+    flags.Parse(args)
+    if flags.NArg() < 1 || flags.NArg() > 2 {
+        fmt.Println("usage: annotate [-engine name] [-depth n | -movetime ms] <input.pgn> [output.pgn]")
+        return
+    }
+
+    games, err := ReadPGNFile(flags.Arg(0))
+    if err != nil {
+        log.Fatal(err)
+    }
+    config, err := loadEngines().Engine(*engineName)
+    if err != nil {
+        log.Fatal(err)
+    }
+    var output io.Writer = os.Stdout
+    if flags.NArg() == 2 {
+        file, err := os.Create(flags.Arg(1))
+        if err != nil {
+            log.Fatal(err)
+        }
+        defer file.Close()
+        output = file
+    }
+
+    if err := annotateGames(context.Background(), config, limits(), games); err != nil {
+        log.Fatal(err)
+    }
+    if err := WritePGNGames(output, games); err != nil {
+        log.Fatal(err)
+    }
+}
+
+// engineFlags are the flags for the engine and its search per ply, limits reads them after parsing
+func engineFlags(flags *flag.FlagSet) (engineName *string, limits func() Limits) {
+    engineName = flags.String("engine", "", "the engine from engines.json, the default engine if empty")
+    depth := flags.Int("depth", 0, "search depth per ply")
+    moveTime := flags.Int("movetime", 0, "search time per ply in milliseconds")
+    return engineName, func() Limits {
+        if *depth <= 0 && *moveTime <= 0 {
+            return Limits{Depth: DEFAULT_ANNOTATE_DEPTH}
+        }
+        return Limits{Depth: *depth, MoveTime: time.Duration(*moveTime) * time.Millisecond}
+    }
+}
+
+// annotateGames starts the engine and annotates the games one by one
+func annotateGames(ctx context.Context, config *EngineConfig, limits Limits, games []*Game) error {
+    process, err := NewProcessEndpoint(config)
+    if err != nil {
+        return err
+    }
+    process.Start()
+    defer process.Terminate()
+    client := NewUciClient(process.Input(), process.Output())
+    client.Start(ctx)
+    if err := client.Handshake(ctx); err != nil {
+        return err
+    }
+    for name, value := range config.Options {
+        if err := client.SetOption(ctx, name, value); err != nil {
+            return err
+        }
+    }
+
+    evaluator := &uciEvaluator{client, limits}
+    for i, game := range games {
+        if err := client.NewGame(ctx); err != nil {
+            return err
+        }
+        log.Printf("annotate: game %d of %d, %s - %s", i + 1, len(games), game.Tag("White"), game.Tag("Black"))
+        if err := Annotate(ctx, game, evaluator); err != nil {
+            return err
+        }
+    }
+    return nil
+}
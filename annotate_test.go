@@ -0,0 +1,90 @@
+package main
+
+
+import (
+    "context"
+    "strings"
+    "testing"
+    "github.com/stretchr/testify/assert"
+)
+
+const SCHOLARS_MATE = `[White "A"]
+[Black "B"]
+[Result "1-0"]
+
+1.e4 e5 2.Qh5 Nc6 3.Bc4 Nf6 4.Qxf7# 1-0
+`
+
+// scriptedEvaluator knows the evaluation after a number of moves
+type scriptedEvaluator map[int]*Evaluation
+
+func (e scriptedEvaluator) Evaluate(ctx context.Context, position Position) (*Evaluation, error) {
+    return e[len(position.Moves)], nil
+}
+
+var SCHOLARS_MATE_EVALUATIONS = scriptedEvaluator{
+    0: {&Score{Value: 30}, []string{"e2e4"}},
+    1: {&Score{Value: -30}, []string{"e7e5"}},
+    2: {&Score{Value: 30}, []string{"g1f3"}},
+    3: {&Score{Value: -20}, []string{"b8c6"}},
+    4: {&Score{Value: 20}, []string{"f1c4"}},
+    5: {&Score{Value: -20}, []string{"g7g6", "h5f3"}},
+    6: {&Score{Mate: true, Value: 1}, []string{"h5f7"}},
+}
+
+func TestAnnotate_01(t *testing.T) {
+    games, _ := ParsePGN(strings.NewReader(SCHOLARS_MATE))
+    game := games[0]
+    err := Annotate(context.Background(), game, SCHOLARS_MATE_EVALUATIONS)
+    assert.Nil(t, err)
+
+    expected := `[Event "?"]
+[Site "?"]
+[Date "????.??.??"]
+[Round "?"]
+[White "A"]
+[Black "B"]
+[Result "1-0"]
+
+{[%eval 0.30]} 1.e4 {[%eval 0.30]} 1...e5 {[%eval 0.30]} 2.Qh5 {[%eval 0.20]}
+2...Nc6 {[%eval 0.20]} 3.Bc4 {[%eval 0.20]} 3...Nf6 $4 {[%eval #1] Blunder. g6
+was best.} (3...g6 {[%eval 0.20]} 4.Qf3) 4.Qxf7# {[%eval #0]} 1-0
+`
+    assert.Equal(t, expected, game.PGN())
+}
+
+func TestAnnotate_assessed_01(t *testing.T) {
+    // a move the author has judged keeps its judgement
+    games, _ := ParsePGN(strings.NewReader(strings.Replace(SCHOLARS_MATE, "Nf6", "Nf6?", 1)))
+    game := games[0]
+    Annotate(context.Background(), game, SCHOLARS_MATE_EVALUATIONS)
+    node := game.MainLine()[5]
+    assert.Equal(t, []int{2}, node.NAGs)
+    assert.Equal(t, 0, len(node.Parent.Children) - 1)
+}
+
+func TestAnnotate_claimable_01(t *testing.T) {
+    // the threefold repetition could be claimed, the game goes on and the engine evaluates it
+    games, _ := ParsePGN(strings.NewReader("1.Nf3 Nf6 2.Ng1 Ng8 3.Nf3 Nf6 4.Ng1 Ng8 *\n"))
+    game := games[0]
+    evaluations := scriptedEvaluator{}
+    for i := 0; i <= 8; i++ {
+        evaluations[i] = &Evaluation{&Score{Value: 25}, []string{"e2e4"}}
+    }
+    assert.Nil(t, Annotate(context.Background(), game, evaluations))
+    last := game.MainLine()[7]
+    assert.True(t, last.Board.CanClaimDraw())
+    assert.Equal(t, &Score{Value: 25}, last.Eval)
+}
+
+func TestJudgement_01(t *testing.T) {
+    nag, _ := judgement(capWinning(centipawns(&Score{Mate: true, Value: 3})) - capWinning(400))
+    assert.Equal(t, 4, nag)
+    nag, _ = judgement(120)
+    assert.Equal(t, 2, nag)
+    nag, _ = judgement(50)
+    assert.Equal(t, 6, nag)
+    nag, _ = judgement(49)
+    assert.Equal(t, 0, nag)
+    assert.Equal(t, -MATE_CP, centipawns(&Score{Mate: true, Value: 0}))
+}
@@ -34,12 +34,19 @@ func BitMain() {
 }
 
 type BitBoard struct {
-    layers map[PieceType]uint64 // layers contain the placements for every piece type
-    specials uint8 // special moves castling, en passant go here
+    layers [PIECE_TYPE_COUNT]uint64 // layers contain the placements for every piece type
+
+    toMove Color
+    castlingRights CastlingRights
+    enPassant uint64 // the square a pawn skipped with a double step, 0 if there is none
+    halfmoveClock int // plies since the last capture or pawn move
+    fullmoveNumber int // starts at 1 and is incremented after every black move
+
+    history []BitBoard // positions before the moves played with Make, newest last
 }
 
 func NewBitBoard(f *Fen) *BitBoard {
-    layers := make(map[PieceType]uint64)
+    var layers [PIECE_TYPE_COUNT]uint64
 
     fenRows := strings.Split(f.boardString, "/") // assert length 8
     // FEN start with 8th rank, flip it
@@ -53,7 +60,27 @@ func NewBitBoard(f *Fen) *BitBoard {
             }
         }
     }
-    return &BitBoard{layers, 0}
+
+    toMove := Color(f.color != "b")
+
+    castlingRights := NO_CASTLING_RIGHTS
+    for _, rn := range f.castling {
+        if castlingType, ok := FEN_TO_CASTLING[string(rn)]; ok {
+            castlingRights |= castlingType.right()
+        }
+    }
+
+    enPassant := uint64(0)
+    if SQUARE_REGEX.MatchString(f.enpassant) {
+        enPassant = NewSquare(f.enpassant).bit()
+    }
+
+    fullmoveNumber := f.move
+    if fullmoveNumber < 1 {
+        fullmoveNumber = 1
+    }
+
+    return &BitBoard{layers, toMove, castlingRights, enPassant, f.halfmoves, fullmoveNumber, nil}
 }
 
 func expandRow(r string) string {
@@ -79,14 +106,22 @@ func NewBitBoardStart() *BitBoard {
 
 func (board *BitBoard) GetPiece(square *Square) PieceType {
     sq_bit := square.bit()
-    for pieceType, layer := range board.layers {
-        if sq_bit & layer != 0 {
+    for _, pieceType := range PIECES {
+        if sq_bit & board.layers[pieceType] != 0 {
             return pieceType
         }
     }
     return NO_PIECE
 }
 
+func (board *BitBoard) WhiteToMove() bool {
+    return board.toMove == WHITE
+}
+
+func (board *BitBoard) MoveNumber() int {
+    return board.fullmoveNumber
+}
+
 func (board *BitBoard) whitePieces() uint64 {
     return board.get(WHITE_PIECES)
 }
@@ -194,12 +229,9 @@ func (board *BitBoard) get(pieceTypes []PieceType) uint64 {
     return result
 }
 
-// there has to be a better solution
 func (board *BitBoard) clearSquare(square_bit uint64) {
-    for pieceType, layer := range board.layers {
-        if layer & square_bit != 0 {
-            board.layers[pieceType] = layer ^ square_bit
-        }
+    for _, pieceType := range PIECES {
+        board.layers[pieceType] &^= square_bit
     }
 }
 
@@ -208,7 +240,53 @@ func (board *BitBoard) occupiedSquares() uint64 {
     return board.get(PIECES)  // PIECES are all (12) piece types
 }
 
+// Make plays a move that can be taken back with Unmake
+func (board *BitBoard) Make(move *Move) {
+    board.history = append(board.history, board.snapshot())
+    board.UpdateBoard(move)
+}
+
+// Unmake takes back the last move played with Make
+func (board *BitBoard) Unmake() {
+    last := len(board.history) - 1
+    if last < 0 {
+        panic("no move to unmake")
+    }
+    history := board.history[:last]
+    *board = board.history[last]
+    board.history = history
+}
+
+// Clone returns a copy of the board that can be changed independently, including the history
+func (board *BitBoard) Clone() *BitBoard {
+    clone := *board
+    clone.history = append([]BitBoard(nil), board.history...)
+    return &clone
+}
+
+// CloneRecent is a Clone that only keeps the positions since the last capture or pawn move,
+// the ones that can repeat. Older moves can't be taken back on the copy.
+func (board *BitBoard) CloneRecent() *BitBoard {
+    clone := *board
+    start := len(board.history) - board.halfmoveClock
+    if start < 0 {
+        start = 0
+    }
+    clone.history = append([]BitBoard(nil), board.history[start:]...)
+    return &clone
+}
+
+// snapshot returns a copy of the current position without its history
+func (board *BitBoard) snapshot() BitBoard {
+    snapshot := *board
+    snapshot.history = nil
+    return snapshot
+}
+
+// UpdateBoard plays a move without remembering the previous position
 func (board *BitBoard) UpdateBoard(move *Move) {
+    board.updateState(move)
+
     if move.isCastling {
         board.handleCastling(move.castlingType)
         return
@@ -233,20 +311,37 @@ func (board *BitBoard) UpdateBoard(move *Move) {
     }
 }
 
-func (board *BitBoard) handleCastling(castlingType CastlingType) {
-    if castlingType.is(WHITE_CASTLING_SHORT) {
-        board.move(WHITE_KING, E1, G1)
-        board.move(WHITE_ROOK, H1, F1)
-    } else if castlingType.is(BLACK_CASTLING_SHORT) {
-        board.move(BLACK_KING, E8, G8)
-        board.move(BLACK_ROOK, H8, F8)
-    } else if castlingType.is(WHITE_CASTLING_LONG) {
-        board.move(WHITE_KING, E1, C1)
-        board.move(WHITE_ROOK, A1, D1)
-    } else if castlingType.is(BLACK_CASTLING_LONG) {
-        board.move(BLACK_KING, E8, C8)
-        board.move(BLACK_ROOK, A8, D8)
+// updateState passes the turn, takes away castling rights,
+// remembers the en passant square and advances the clocks
+func (board *BitBoard) updateState(move *Move) {
+    if move.pieceType.is(PAWN) || move.isCapture {
+        board.halfmoveClock = 0
+    } else {
+        board.halfmoveClock++
     }
+    if board.toMove == BLACK {
+        board.fullmoveNumber++
+    }
+    board.toMove = !board.toMove
+
+    board.castlingRights &^= CASTLING_RIGHTS_LOST[move.initialSquare.bit()]
+    board.castlingRights &^= CASTLING_RIGHTS_LOST[move.targetSquare.bit()]
+
+    board.enPassant = 0
+    if move.pieceType.is(PAWN) {
+        fromFile, fromRank := move.initialSquare.coords()
+        _,        toRank   := move.targetSquare.coords()
+        if toRank - fromRank == 2 || fromRank - toRank == 2 {
+            shift := uint(8 * ((fromRank + toRank) / 2) + fromFile)
+            board.enPassant = 1 << shift
+        }
+    }
+}
+
+func (board *BitBoard) handleCastling(castlingType CastlingType) {
+    castling := CASTLING_MOVES[castlingType]
+    board.move(castling.kingType, castling.king, castling.kingTarget)
+    board.move(castling.rookType, castling.rook, castling.rookTarget)
 }
 
 func (board *BitBoard) move(pieceType PieceType, from uint64, to uint64) {
@@ -254,40 +349,118 @@ func (board *BitBoard) move(pieceType PieceType, from uint64, to uint64) {
     board.layers[pieceType] |= to
 }
 
-// TODO: needs some refactoring
+// isCheck tells if the pieces of the given color give check to the opponent king
 func (board *BitBoard) isCheck(color Color) bool {
-    var pieceTypes []PieceType
     var kingbit uint64
     if color == WHITE {
-        pieceTypes = WHITE_PIECES
         kingbit = board.layers[BLACK_KING]
     } else {
-        pieceTypes = BLACK_PIECES
         kingbit = board.layers[WHITE_KING]
     }
 
+    return kingbit & board.attacks(color) != 0
+}
+
+// attacks returns all squares that are attacked by the pieces of the given color
+func (board *BitBoard) attacks(color Color) uint64 {
+    pieceTypes := BLACK_PIECES
+    if color == WHITE {
+        pieceTypes = WHITE_PIECES
+    }
+
     whitePieces := board.whitePieces()
     blackPieces := board.blackPieces()
 
     attacked := uint64(0)
     for _, pieceType := range pieceTypes {
-        if pieceType.is(PAWN) || pieceType.is(KING) {
-            continue  // still need to implement moves for king and pawn
+        for _, position := range findBitPositions(board.layers[pieceType]) {
+            piece := NewPiece(pieceType, NewSquareByNum(position))
+            if pieceType.is(PAWN) {
+                // pawns don't capture the way they move
+                attacked |= piece.Mask()
+            } else {
+                attacked |= piece.Moves(whitePieces, blackPieces)
+            }
         }
+    }
+    return attacked
+}
 
-        pieces := []Mover{}
-        positions := findBitPositions(board.layers[pieceType])
-        for _, position := range positions {
-            sq := NewSquareByNum(position)
-            pieces = append(pieces, NewPiece(pieceType, sq))
+// LegalMoves returns every legal move for the side to move
+func (board *BitBoard) LegalMoves() []*Move {
+    moves := []*Move{}
+    for _, uciMove := range board.pseudoLegalMoves() {
+        move := NewMove(uciMove, board)
+        if board.isLegal(move) {
+            moves = append(moves, move)
         }
+    }
+    return moves
+}
+
+// isLegal checks that a move does not leave the own king in check
+func (board *BitBoard) isLegal(move *Move) bool {
+    board.Make(move)
+    defer board.Unmake()
+    return !board.isCheck(board.toMove)
+}
 
-        for _, piece := range pieces {
-            attacked |= piece.Moves(whitePieces, blackPieces)
+// pseudoLegalMoves returns all moves in uci notation for the side to move
+// without looking whether the own king is in check afterwards
+func (board *BitBoard) pseudoLegalMoves() []string {
+    pieceTypes := BLACK_PIECES
+    if board.toMove == WHITE {
+        pieceTypes = WHITE_PIECES
+    }
+
+    whitePieces := board.whitePieces()
+    blackPieces := board.blackPieces()
+
+    result := []string{}
+    for _, pieceType := range pieceTypes {
+        for _, from := range findBitPositions(board.layers[pieceType]) {
+            piece := NewPiece(pieceType, NewSquareByNum(from))
+            targets := piece.Moves(whitePieces, blackPieces)
+            if pieceType.is(PAWN) {
+                targets |= piece.Mask() & board.enPassant
+            }
+            for _, to := range findBitPositions(targets) {
+                uciMove := squareName(from) + squareName(to)
+                if pieceType.is(PAWN) && (uint64(1) << uint(to)) & (Rank1BB | Rank8BB) != 0 {
+                    for _, promotion := range UCI_PROMOTIONS {
+                        result = append(result, uciMove + promotion)
+                    }
+                } else {
+                    result = append(result, uciMove)
+                }
+            }
         }
     }
+    return append(result, board.castlingMoves()...)
+}
+
+// castlingMoves returns the castling moves in uci notation for the side to move
+func (board *BitBoard) castlingMoves() []string {
+    result := []string{}
+    occupied := board.occupiedSquares()
+    attacked := uint64(0)
+
+    for _, castlingType := range CASTLING_TYPES[board.toMove] {
+        if !board.castlingRights.has(castlingType) { continue }
+
+        castling := CASTLING_MOVES[castlingType]
+        if board.layers[castling.kingType] & castling.king == 0 { continue }
+        if board.layers[castling.rookType] & castling.rook == 0 { continue }
+        if occupied & castling.between != 0 { continue }
+
+        if attacked == 0 {
+            attacked = board.attacks(!board.toMove)
+        }
+        if attacked & castling.passing != 0 { continue }
 
-    return kingbit & attacked == kingbit
+        result = append(result, castling.uciMove)
+    }
+    return result
 }
 
 func (board *BitBoard) Pretty() {
@@ -362,6 +535,11 @@ func testSquareToBit(square string) {
     fmt.Println()
 }
 
+// squareName returns the name of a square given as number from 0 to 63, e.g. 12 -> "e2"
+func squareName(num int) string {
+    return string(rune('a' + num % 8)) + string(rune('1' + num / 8))
+}
+
 func shift(number uint64, steps int) uint64 {
     if steps > 0 {
         return number << uint(steps)
@@ -384,6 +562,8 @@ const DELTA_SW = DELTA_S + DELTA_W
 var DELTAS_BISHOP = []int{DELTA_NW, DELTA_NE, DELTA_SE, DELTA_SW}
 var DELTAS_QUEEN = append(DELTAS_ROOK, DELTAS_BISHOP...)
 var DELTAS_KING = DELTAS_QUEEN
+var DELTAS_WHITE_PAWN = []int{DELTA_NW, DELTA_NE}
+var DELTAS_BLACK_PAWN = []int{DELTA_SW, DELTA_SE}
 
 const DELTA_NNW = 2 * DELTA_N + DELTA_W
 const DELTA_NNE = 2 * DELTA_N + DELTA_E
@@ -422,9 +602,77 @@ func NewPiece(pieceType PieceType, square *Square) Mover {
         return NewQueen(square, color)
     } else if pieceType.is(KNIGHT) {
         return NewKnight(square, color)
+    } else if pieceType.is(KING) {
+        return NewKing(square, color)
+    } else if pieceType.is(PAWN) {
+        return NewPawn(square, color)
     } else {
-        panic("More pieces coming soon...")
+        panic("Need a piece to move")
+    }
+}
+
+// heroAndOpp sorts the white and black pieces into own and opponent pieces
+func heroAndOpp(color Color, white_pieces uint64, black_pieces uint64) (uint64, uint64) {
+    if color == WHITE {
+        return white_pieces, black_pieces
+    } else {
+        return black_pieces, white_pieces
+    }
+}
+
+// King moves do not contain castling, this is up to the board
+type King struct {
+    square *Square
+    color Color
+}
+
+func NewKing(square *Square, color Color) *King {
+    return &King{square, color}
+}
+
+func (p *King) Name() string { return "King" }
+func (p *King) Square() *Square { return p.square }
+func (p *King) Color() Color { return p.color }
+func (p *King) Deltas() []int { return DELTAS_KING }
+func (p *King) Mask() uint64 { return kingMask(p.square) }
+func (p *King) Moves(white_pieces uint64, black_pieces uint64) uint64 {
+    hero_pieces, _ := heroAndOpp(p.Color(), white_pieces, black_pieces)
+    return p.Mask() &^ hero_pieces
+}
+
+// Pawn moves do not contain en passant, this is up to the board.
+// The mask of a pawn are the squares it attacks.
+type Pawn struct {
+    square *Square
+    color Color
+}
+
+func NewPawn(square *Square, color Color) *Pawn {
+    return &Pawn{square, color}
+}
+
+func (p *Pawn) Name() string { return "Pawn" }
+func (p *Pawn) Square() *Square { return p.square }
+func (p *Pawn) Color() Color { return p.color }
+func (p *Pawn) Deltas() []int {
+    if p.Color() == WHITE { return DELTAS_WHITE_PAWN } else { return DELTAS_BLACK_PAWN }
+}
+func (p *Pawn) Mask() uint64 { return pawnMask(p.square, p.color) }
+func (p *Pawn) Moves(white_pieces uint64, black_pieces uint64) uint64 {
+    _, opp_pieces := heroAndOpp(p.Color(), white_pieces, black_pieces)
+    empty := ^(white_pieces | black_pieces)
+
+    forward := DELTA_N
+    doubleStepRank := uint64(Rank3BB)
+    if p.Color() == BLACK {
+        forward = DELTA_S
+        doubleStepRank = Rank6BB
     }
+
+    push := shift(p.square.bit(), forward) & empty
+    push |= shift(push & doubleStepRank, forward) & empty
+
+    return push | (p.Mask() & opp_pieces)
 }
 
 type Knight struct {
@@ -521,6 +769,10 @@ func getSlidingMoves(piece Mover, white_pieces uint64, black_pieces uint64) uint
     for _, delta := range deltas {
         x := square_bit
         for {
+            if (x & edgeMask(delta)) != 0 {
+                // next step would wrap around to the other side of the board
+                break
+            }
             x = shift(x, delta)
             if (x & mask) == 0 {
                 // move over the edge of the board
@@ -544,6 +796,17 @@ func getSlidingMoves(piece Mover, white_pieces uint64, black_pieces uint64) uint
     return result
 }
 
+// edgeMask returns the file a piece must not leave in the direction of delta
+func edgeMask(delta int) uint64 {
+    switch delta {
+    case DELTA_E, DELTA_NE, DELTA_SE:
+        return FileHBB
+    case DELTA_W, DELTA_NW, DELTA_SW:
+        return FileABB
+    }
+    return 0
+}
+
 func testPieceMoves(pieceType PieceType, square *Square, white_pieces uint64, black_pieces uint64) {
     p := NewPiece(pieceType, square)
     b := p.Moves(white_pieces, black_pieces)
@@ -551,7 +814,7 @@ func testPieceMoves(pieceType PieceType, square *Square, white_pieces uint64, bl
     pretty(white_pieces)
     fmt.Println("black pieces:")
     pretty(black_pieces)
-    fmt.Printf("%s on %s can move to:\n", pieceType, square)
+    fmt.Printf("%s on %s can move to:\n", PIECE_TO_FEN[pieceType], square.name)
     pretty(b)
 }
 
@@ -614,6 +877,34 @@ func knightMask(square *Square) uint64 {
     return result
 }
 
+// kingMask returns all the squares a king can reach from a given square on an empty board.
+func kingMask(square *Square) uint64 {
+    return stepMask(square, DELTAS_KING)
+}
+
+// pawnMask returns the squares a pawn attacks from a given square.
+func pawnMask(square *Square, color Color) uint64 {
+    if color == WHITE {
+        return stepMask(square, DELTAS_WHITE_PAWN)
+    } else {
+        return stepMask(square, DELTAS_BLACK_PAWN)
+    }
+}
+
+// stepMask returns the squares reached by a single step in each direction
+func stepMask(square *Square, deltas []int) uint64 {
+    sq_num := square.num() // sq_num in 0..63
+    result := uint64(0)
+    for _, delta := range deltas {
+        mod_diff := (sq_num % 8) - ((sq_num + delta) % 8)
+        if mod_diff < 0 { mod_diff = -mod_diff }  // abs
+        if sq_num + delta >= 0 && sq_num + delta <= 63 && mod_diff < 2 {
+            result |= (1 << uint(sq_num + delta))
+        }
+    }
+    return result
+}
+
 func testKnightMask(square_str string) {
     fmt.Printf("Knight mask on \"%s\":\n", square_str)
     square := NewSquare(square_str)
@@ -0,0 +1,165 @@
+package main
+
+
+import (
+    "sort"
+    "testing"
+    "github.com/stretchr/testify/assert"
+)
+
+func uciMoves(moves []*Move) []string {
+    result := []string{}
+    for _, move := range moves {
+        result = append(result, move.uciMove)
+    }
+    sort.Strings(result)
+    return result
+}
+
+func TestLegalMoves_01(t *testing.T) {
+    // start position
+    board := NewBitBoardStart()
+    assert.Equal(t, 20, len(board.LegalMoves()))
+}
+
+func TestLegalMoves_02(t *testing.T) {
+    // en passant after a double step of the black pawn
+    board := NewBitBoard(NewFen("4k3/3p4/8/4P3/8/8/8/4K3 b - - 0 1"))
+    board.UpdateBoard(NewMove("d7d5", board))
+    assert.Contains(t, uciMoves(board.LegalMoves()), "e5d6")
+}
+
+func TestLegalMoves_03(t *testing.T) {
+    // castling is not allowed through an attacked square
+    board := NewBitBoard(NewFen("r3k2r/8/8/8/8/8/8/R3K2R w KQkq - 0 1"))
+    moves := uciMoves(board.LegalMoves())
+    assert.Contains(t, moves, "e1g1")
+    assert.Contains(t, moves, "e1c1")
+
+    board = NewBitBoard(NewFen("r3k2r/8/8/8/8/8/5r2/R3K2R w KQ - 0 1"))
+    moves = uciMoves(board.LegalMoves())
+    assert.NotContains(t, moves, "e1g1")  // f1 is attacked
+    assert.Contains(t, moves, "e1c1")
+
+    board = NewBitBoard(NewFen("r3k2r/8/8/8/8/8/8/R3K1rR w KQ - 0 1"))
+    moves = uciMoves(board.LegalMoves())
+    assert.NotContains(t, moves, "e1c1")  // king is in check
+}
+
+func TestLegalMoves_04(t *testing.T) {
+    // castling rights are lost when the rook moves
+    board := NewBitBoard(NewFen("r3k2r/8/8/8/8/8/8/R3K2R w KQkq - 0 1"))
+    board.UpdateBoard(NewMove("h1h2", board))
+    board.UpdateBoard(NewMove("a8b8", board))
+    board.UpdateBoard(NewMove("h2h1", board))
+    board.UpdateBoard(NewMove("b8a8", board))
+    moves := uciMoves(board.LegalMoves())
+    assert.NotContains(t, moves, "e1g1")
+    assert.Contains(t, moves, "e1c1")
+}
+
+func TestLegalMoves_05(t *testing.T) {
+    // promotions
+    board := NewBitBoard(NewFen("1n2k3/P7/8/8/8/8/8/4K3 w - - 0 1"))
+    moves := uciMoves(board.LegalMoves())
+    for _, uciMove := range []string{"a7a8q", "a7a8r", "a7a8b", "a7a8n", "a7b8q", "a7b8n"} {
+        assert.Contains(t, moves, uciMove)
+    }
+}
+
+func TestLegalMoves_06(t *testing.T) {
+    // the pinned knight can't move, the king must not step into check
+    board := NewBitBoard(NewFen("4r1k1/8/8/8/8/8/4N3/4K2r w - - 0 1"))
+    moves := uciMoves(board.LegalMoves())
+    assert.Equal(t, []string{"e1d2", "e1f2"}, moves)
+}
+
+func TestQueenMoves_01(t *testing.T) {
+    // a queen on the h-file must not wrap around to the a-file
+    queen := NewPiece(WHITE_QUEEN, NewSquare("h3"))
+    moves := queen.Moves(setPieces("h3", "g3", "g2"), 0)
+    assert.Equal(t, uint64(0), moves & setPieces("a2", "a3", "a4"))
+}
+
+func playMoves(board *BitBoard, uciMoves ...string) {
+    for _, uciMove := range uciMoves {
+        board.UpdateBoard(NewMove(uciMove, board))
+    }
+}
+
+func TestUpdateBoard_state_01(t *testing.T) {
+    // side to move, en passant square and clocks
+    board := NewBitBoardStart()
+    playMoves(board, "e2e4")
+    assert.Equal(t, BLACK, board.toMove)
+    assert.Equal(t, uint64(E3), board.enPassant)
+    assert.Equal(t, 0, board.halfmoveClock)
+    assert.Equal(t, 1, board.fullmoveNumber)
+
+    playMoves(board, "e7e5", "g1f3", "b8c6")
+    assert.Equal(t, WHITE, board.toMove)
+    assert.Equal(t, uint64(0), board.enPassant)
+    assert.Equal(t, 2, board.halfmoveClock)
+    assert.Equal(t, 3, board.fullmoveNumber)
+
+    playMoves(board, "f3e5")
+    assert.Equal(t, 0, board.halfmoveClock)
+}
+
+func TestUpdateBoard_state_02(t *testing.T) {
+    // castling rights are lost by king moves and captured rooks
+    board := NewBitBoard(NewFen("r3k2r/8/8/8/8/8/6b1/R3K2R b KQkq - 3 20"))
+    playMoves(board, "g2h1")
+    assert.False(t, board.castlingRights.has(WHITE_CASTLING_SHORT))
+    assert.True(t, board.castlingRights.has(WHITE_CASTLING_LONG))
+    assert.Equal(t, 0, board.halfmoveClock)
+    assert.Equal(t, 21, board.fullmoveNumber)
+
+    playMoves(board, "e1d1", "e8g8")
+    assert.Equal(t, NO_CASTLING_RIGHTS, board.castlingRights)
+    assert.Equal(t, 2, board.halfmoveClock)
+}
+
+func TestNewBitBoard_state_01(t *testing.T) {
+    board := NewBitBoard(NewFen("rnbqkbnr/ppp1p1pp/8/3pPp2/8/8/PPPP1PPP/RNBQKBNR w Kq f6 0 3"))
+    assert.True(t, board.WhiteToMove())
+    assert.Equal(t, 3, board.MoveNumber())
+    assert.Equal(t, uint64(F6), board.enPassant)
+    assert.Equal(t, WHITE_CASTLING_SHORT.right() | BLACK_CASTLING_LONG.right(), board.castlingRights)
+}
+
+func TestMakeUnmake_01(t *testing.T) {
+    fenString := "r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R w KQkq - 0 1"
+    board := NewBitBoard(NewFen(fenString))
+    for _, uciMove := range []string{"e1g1", "e1c1", "e5f7", "d5e6", "f3h3", "a2a4"} {
+        board.Make(NewMove(uciMove, board))
+        assert.NotEqual(t, fenString, board.FEN())
+        board.Unmake()
+        assert.Equal(t, fenString, board.FEN(), uciMove)
+    }
+}
+
+func TestMakeUnmake_02(t *testing.T) {
+    // en passant and promotion are taken back
+    board := NewBitBoard(NewFen("4k3/1P6/8/8/3p4/8/4P3/4K3 w - - 0 1"))
+    board.Make(NewMove("e2e4", board))
+    board.Make(NewMove("d4e3", board))
+    board.Make(NewMove("b7b8n", board))
+    assert.Equal(t, "1N2k3/8/8/8/8/4p3/8/4K3 b - - 0 2", board.FEN())
+    board.Unmake()
+    board.Unmake()
+    assert.Equal(t, "4k3/1P6/8/8/3pP3/8/8/4K3 b - e3 0 1", board.FEN())
+    board.Unmake()
+    assert.Equal(t, "4k3/1P6/8/8/3p4/8/4P3/4K3 w - - 0 1", board.FEN())
+}
+
+func TestClone_01(t *testing.T) {
+    board := NewBitBoardStart()
+    board.Make(NewMove("e2e4", board))
+    clone := board.Clone()
+    clone.Make(NewMove("e7e5", clone))
+    clone.Unmake()
+    clone.Unmake()
+    assert.Equal(t, STARTPOSITION, clone.FEN())
+    assert.Equal(t, "rnbqkbnr/pppppppp/8/8/4P3/8/PPPP1PPP/RNBQKBNR b KQkq e3 0 1", board.FEN())
+}
@@ -1,9 +1,6 @@
 package main
 
 
-import "fmt"
-
-
 type Color bool
 
 const WHITE Color = true
@@ -38,6 +35,9 @@ const (
     BLACK_PAWN // = 22
 )
 
+// PIECE_TYPE_COUNT is the size of an array indexed by PieceType
+const PIECE_TYPE_COUNT = BLACK_PAWN + 1
+
 // typeOf takes a some piece and checks for piece type
 func (pieceType PieceType) is(otherType PieceType) bool {
     return pieceType % 8 == otherType
@@ -258,6 +258,62 @@ func (c CastlingType) String() string {
     return CASTLING_TO_STRING[c]
 }
 
+// CastlingRights is a bit set with one bit per CastlingType
+type CastlingRights uint8
+
+const NO_CASTLING_RIGHTS CastlingRights = 0
+
+func (c CastlingType) right() CastlingRights {
+    return 1 << c
+}
+
+func (r CastlingRights) has(c CastlingType) bool {
+    return r & c.right() != 0
+}
+
+var FEN_TO_CASTLING = map[string]CastlingType{
+    "K": WHITE_CASTLING_SHORT,
+    "Q": WHITE_CASTLING_LONG,
+    "k": BLACK_CASTLING_SHORT,
+    "q": BLACK_CASTLING_LONG,
+}
+
+var CASTLING_TYPES = map[Color][]CastlingType{
+    WHITE: []CastlingType{WHITE_CASTLING_SHORT, WHITE_CASTLING_LONG},
+    BLACK: []CastlingType{BLACK_CASTLING_SHORT, BLACK_CASTLING_LONG},
+}
+
+// CastlingMove describes which squares are involved in castling
+type CastlingMove struct {
+    uciMove string
+    kingType PieceType
+    rookType PieceType
+    king uint64       // initial square of the king
+    kingTarget uint64
+    rook uint64       // initial square of the rook
+    rookTarget uint64
+    between uint64    // squares that have to be empty
+    passing uint64    // squares that must not be attacked, including the initial king square
+}
+
+var CASTLING_MOVES = map[CastlingType]CastlingMove{
+    WHITE_CASTLING_SHORT: CastlingMove{"e1g1", WHITE_KING, WHITE_ROOK, E1, G1, H1, F1, F1 | G1, E1 | F1 | G1},
+    WHITE_CASTLING_LONG:  CastlingMove{"e1c1", WHITE_KING, WHITE_ROOK, E1, C1, A1, D1, B1 | C1 | D1, E1 | D1 | C1},
+    BLACK_CASTLING_SHORT: CastlingMove{"e8g8", BLACK_KING, BLACK_ROOK, E8, G8, H8, F8, F8 | G8, E8 | F8 | G8},
+    BLACK_CASTLING_LONG:  CastlingMove{"e8c8", BLACK_KING, BLACK_ROOK, E8, C8, A8, D8, B8 | C8 | D8, E8 | D8 | C8},
+}
+
+// CASTLING_RIGHTS_LOST maps a square to the castling rights that are gone
+// as soon as a piece moves from or to this square
+var CASTLING_RIGHTS_LOST = map[uint64]CastlingRights{
+    E1: WHITE_CASTLING_SHORT.right() | WHITE_CASTLING_LONG.right(),
+    H1: WHITE_CASTLING_SHORT.right(),
+    A1: WHITE_CASTLING_LONG.right(),
+    E8: BLACK_CASTLING_SHORT.right() | BLACK_CASTLING_LONG.right(),
+    H8: BLACK_CASTLING_SHORT.right(),
+    A8: BLACK_CASTLING_LONG.right(),
+}
+
 const A1 = 1 << 0
 const B1 = 1 << 1
 const C1 = 1 << 2
@@ -329,6 +385,8 @@ type PromotionKey struct {
     uciPromotion string
 }
 
+var UCI_PROMOTIONS = []string{"q", "r", "b", "n"}
+
 var PROMOTION_TO_PIECE = map[PromotionKey]PieceType {
     PromotionKey{WHITE, "q"} : WHITE_QUEEN,
     PromotionKey{WHITE, "r"} : WHITE_ROOK,
@@ -2,11 +2,17 @@ package main
 
 
 import (
+    "context"
+    "encoding/json"
     "os/exec"
     "fmt"
+    "log"
     "regexp"
+    "sort"
     "strconv"
     "strings"
+    "sync"
+    "time"
 )
 
 func engineAvailable(name string) bool {
@@ -20,139 +26,502 @@ func engineAvailable(name string) bool {
     }
 }
 
-func NewEngine(engineName string) *Engine {
+func NewEngine(config *EngineConfig) *Engine {
 
-    engineAvailable(engineName)
-    //process, _ := launchCmd(engineName, []string{}, []string{})
+    engineAvailable(config.Path)
 
 	return &Engine{
-		process:    NewProcessEndpoint(engineName),
-		output:     make(chan string),
+		config:     config,
+		key:        engineKey(config.Path),
+		options:    DefaultOptionStore(),
+		restart:    DEFAULT_RESTART_POLICY,
+		output:     make(chan *EngineOutput),
 		input:      make(chan string),
-		err:        make(chan bool),
+		terminated: make(chan struct{}),
+		done:       make(chan struct{}),
     }
 }
 
+// Engine is an engine process that is restarted when it crashes
 type Engine struct {
-    process    *ProcessEndpoint
-	output     chan string
+    config     *EngineConfig
+    key        string // the engine binary, the chosen options are stored under it
+    options    *OptionStore
+    restart    RestartPolicy
+	output     chan *EngineOutput
 	input      chan string
-	err        chan bool
+
+    mu         sync.Mutex
+    process    *ProcessEndpoint // the running process, replaced on a restart
+    client     *UciClient
+    terminated chan struct{}
+    terminateOnce sync.Once
+    startOnce  sync.Once
+    done       chan struct{} // closed when the supervisor has ended, the engine was terminated or given up
 }
 
-func (eng *Engine) Output() chan string { return eng.output }
+func (eng *Engine) Name() string { return eng.config.Name }
+func (eng *Engine) Output() chan *EngineOutput { return eng.output }
 func (eng *Engine) Input() chan string { return eng.input }
-func (eng *Engine) Err() chan bool { return eng.err }
+func (eng *Engine) Done() <-chan struct{} { return eng.done }
+
+// Terminate stops the engine process, it is not restarted anymore.
+// It returns when the process and the goroutines of the engine have ended.
+func (eng *Engine) Terminate() {
+    eng.terminateOnce.Do(func() { close(eng.terminated) })
+    eng.mu.Lock()
+    process := eng.process
+    eng.mu.Unlock()
+    if process != nil {
+        process.Terminate()
+    }
+    eng.startOnce.Do(func() { close(eng.done) }) // never started
+    <-eng.done
+}
 
-func (eng *Engine) Terminate() { eng.process.Terminate() }
+// Start launches the engine process under supervision, the engine is terminated when ctx is done
+func (eng *Engine) Start(ctx context.Context) {
+    eng.startOnce.Do(func() {
+        go func() {
+            defer close(eng.done)
+            eng.supervise()
+        }()
+        go func() {
+            select {
+            case <-ctx.Done():
+                eng.Terminate()
+            case <-eng.done:
+            }
+        }()
+    })
+}
 
-func (eng *Engine) Start() {
-    eng.process.Start()
-    go talk(eng.input, eng.output,
-            eng.process.Input(), eng.process.Output(),
-            eng.err, eng.process.Err())
+// Analyze starts a search on the engine, see UciClient.Analyze
+func (eng *Engine) Analyze(ctx context.Context, position Position, limits Limits) (*Search, error) {
+    eng.mu.Lock()
+    client := eng.client
+    eng.mu.Unlock()
+    if client == nil {
+        return nil, fmt.Errorf("engine %s is not running", eng.Name())
+    }
+    return client.Analyze(ctx, position, limits)
+}
+
+// send passes output to the user, it is dropped when the engine is terminated
+func (eng *Engine) send(output *EngineOutput) {
+    select {
+    case eng.output <- output:
+    case <-eng.terminated:
+    }
 }
 
 type AnalysisState struct {
     started bool
-    fen *Fen
+    board *BitBoard // the position the engine analyzes, never changed by printing lines
+    lines *RankedLines // the candidate moves of the current search
+    pending map[int]string // the newest info line of every multipv slot since the last update
+
+    // the commands that bring a restarted engine back to where it was
+    position string
+    goCmd string
+    options map[string]string // setoption commands by option name
 }
 
-var REGEX_POSITION_FEN = regexp.MustCompile(`position fen (?P<fenString>.*)`)
+var REGEX_POSITION = regexp.MustCompile(`^position\s+(?:startpos|fen\s+(.*?))(?:\s+moves\s+(.*))?$`)
+var REGEX_SETOPTION_MULTIPV = regexp.MustCompile(`(?i)^setoption name multipv value (\d+)`)
+var REGEX_MULTIPV = regexp.MustCompile(`^multipv (\d+)$`)
 
 func (as *AnalysisState) CmdUpdate(cmd string) {
     if regexp.MustCompile(`^go`).MatchString(cmd) {
         as.started = true
+        as.goCmd = cmd
+        as.resetLines()
+    }
+    if strings.HasPrefix(cmd, "position") {
+        as.position = cmd
     }
-    if REGEX_POSITION_FEN.MatchString(cmd) {
-        match := REGEX_POSITION_FEN.FindStringSubmatch(cmd)
-        as.fen = NewFen(match[1])
+    if name, _, ok := parseSetOption(cmd); ok {
+        as.options[strings.ToLower(name)] = cmd
     }
+    if REGEX_MULTIPV.MatchString(cmd) {
+        // the multipv of an analysis is replayed the same way, it takes the place of the option
+        as.options["multipv"] = cmd
+    }
+    for _, regex := range []*regexp.Regexp{REGEX_SETOPTION_MULTIPV, REGEX_MULTIPV} {
+        if match := regex.FindStringSubmatch(cmd); match != nil {
+            n, _ := strconv.Atoi(match[1])
+            as.lines.SetMaxLines(n)
+        }
+    }
+    if fenString, moves, ok := ParsePositionCommand(cmd); ok {
+        board, err := positionBoard(fenString, moves)
+        if err != nil {
+            log.Println(err)
+            return
+        }
+        as.board = board
+        as.resetLines()
+    }
+}
+
+// ParsePositionCommand reads a "position" command, the fen is empty for startpos
+func ParsePositionCommand(cmd string) (string, []string, bool) {
+    match := REGEX_POSITION.FindStringSubmatch(strings.TrimSpace(cmd))
+    if match == nil {
+        return "", nil, false
+    }
+    return match[1], strings.Fields(match[2]), true
 }
 
-func (as *AnalysisState) WhiteToMove() bool {
-    if as.fen.color == "w" { return true } else { return false }
+// positionBoard plays the moves from the fen or the start position, the fen and every move must be valid
+func positionBoard(fenString string, moves []string) (*BitBoard, error) {
+    board := NewBitBoardStart()
+    if fenString != "" {
+        fen, err := ParseFen(fenString)
+        if err != nil {
+            return nil, err
+        }
+        board = NewBitBoard(fen)
+    }
+    for _, uciMove := range moves {
+        var legal *Move
+        for _, move := range board.LegalMoves() {
+            if move.uciMove == uciMove {
+                legal = move
+            }
+        }
+        if legal == nil {
+            return nil, fmt.Errorf("position: illegal move %s in %s", uciMove, board.FEN())
+        }
+        board.Make(legal)
+    }
+    return board, nil
 }
 
-func (as *AnalysisState) MoveNumber() int {
-    return as.fen.move
+// rankedUpdate stores a line of the running search and returns the update with the ranked lines,
+// nil if they haven't changed. The update is a copy, a stored line never contains the lines.
+func (as *AnalysisState) rankedUpdate(output *EngineOutput) *EngineOutput {
+    if !as.lines.Update(output) {
+        return nil
+    }
+    update := *output
+    update.Lines = as.lines.Lines()
+    return &update
 }
 
 // FEN start position: rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1
 const STARTPOSITION = "rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1"
 
+// NewAnalysisState starts at a fen that is known to be valid, the positions of the user come with CmdUpdate
 func NewAnalysisState(fenString string) *AnalysisState {
-
-    fen := NewFen(fenString)
     return &AnalysisState{
-        fen: fen,
+        board: NewBitBoard(NewFen(fenString)),
+        lines: NewRankedLines(),
+        pending: make(map[int]string),
+        options: make(map[string]string),
+    }
+}
+
+func (as *AnalysisState) resetLines() {
+    as.lines.Reset()
+    as.pending = make(map[int]string)
+}
+
+// coalesce keeps an info line with a pv until the next update, an older line of the same
+// multipv slot is dropped. The result is false if the line has no pv, it goes to the user as it is.
+func (as *AnalysisState) coalesce(msg string) bool {
+    if !strings.HasPrefix(msg, "info") || !strings.Contains(msg, " pv ") {
+        return false
     }
+    info, err := ParseInfoLine(msg)
+    if err != nil || len(info.PV) == 0 {
+        return false
+    }
+    as.pending[info.Rank()] = msg
+    return true
 }
 
-func talk(engine_in, engine_out, process_in, process_out chan string, engine_err, process_err chan bool) {
-    //analysisStarted := false
-    as := NewAnalysisState(STARTPOSITION)
+// flush turns the kept lines into an update of the ranked lines, nil if the lines didn't change.
+// Only here the pv is printed, that's the expensive part.
+func (as *AnalysisState) flush() *EngineOutput {
+    ranks := []int{}
+    for rank := range as.pending {
+        ranks = append(ranks, rank)
+    }
+    sort.Ints(ranks)
+    var update *EngineOutput
+    for _, rank := range ranks {
+        if ranked := as.rankedUpdate(NewEngineOutput(as.pending[rank], as)); ranked != nil {
+            update = ranked
+        }
+    }
+    as.pending = make(map[int]string)
+    return update
+}
+
+// OUTBOX_SIZE is how many outputs wait for a slow user, beyond it the oldest are dropped
+const OUTBOX_SIZE = 256
+
+// outbox keeps the output until the user takes it, so that a slow user never stops the engine.
+// A newer update of the lines replaces one that still waits. When the outbox is full the oldest
+// output is dropped, the best moves and the errors of the engine go last.
+type outbox []*EngineOutput
+
+func (box *outbox) push(output *EngineOutput) {
+    if output == nil {
+        return
+    }
+    if n := len(*box); n > 0 && output.Lines != nil && (*box)[n - 1].Lines != nil {
+        (*box)[n - 1] = output
+        return
+    }
+    *box = append(*box, output)
+    if len(*box) <= OUTBOX_SIZE {
+        return
+    }
+    drop := 0
+    for i, queued := range *box {
+        if !queued.final() {
+            drop = i
+            break
+        }
+    }
+    log.Printf("engine: the user falls behind, %s is dropped", (*box)[drop].Raw)
+    *box = append((*box)[:drop], (*box)[drop + 1:]...)
+}
+
+// final tells whether the user waits for the output, a best move or an error of the engine
+func (output *EngineOutput) final() bool {
+    return output.Error != nil || strings.HasPrefix(output.Raw, "bestmove")
+}
+
+// replayCommands are the options and the position set by the user and the search if one was running
+func (as *AnalysisState) replayCommands() []string {
+    cmds := []string{}
+    for _, cmd := range as.options {
+        cmds = append(cmds, cmd)
+    }
+    sort.Strings(cmds)
+    if as.position != "" {
+        cmds = append(cmds, as.position)
+    }
+    if as.started {
+        cmds = append(cmds, as.goCmd)
+    }
+    return cmds
+}
+
+// talk passes commands to the engine process and its output to the user until the process ends.
+// After a restart the commands of the user are replayed. During a search the lines are
+// coalesced and sent at most once per output interval of the engine. The commands to the
+// engine give up when ctx is done, e.g. when the engine is terminated.
+func talk(ctx context.Context, eng *Engine, process *ProcessEndpoint, client *UciClient, as *AnalysisState, replay bool) {
+    ctx, cancel := context.WithCancel(ctx)
+    defer cancel()
+
+    // the configured and stored options go the same way as the ones the user sets,
+    // the values the user has chosen come last and win
+    cmds := []string{}
+    for _, values := range []map[string]string{eng.config.Options, eng.options.Values(eng.key)} {
+        for name, value := range values {
+            cmds = append(cmds, fmt.Sprintf("setoption name %s value %s", name, value))
+        }
+    }
+    if replay {
+        cmds = append(cmds, as.replayCommands()...)
+        as.started = false
+    }
+    commands := make(chan string)
+
+    go func() {
+        err := client.Handshake(ctx)
+        if err == nil {
+            err = client.IsReady(ctx)
+        }
+        if err != nil {
+            log.Println(err)
+            return
+        }
+        for _, cmd := range cmds {
+            select {
+            case commands <- cmd:
+            case <-ctx.Done():
+                return
+            }
+        }
+    }()
+
+    var box outbox
+    var flush <-chan time.Time // set while there are lines to update
+    defer func() {
+        // the last output goes to the user before the supervisor tells how the process ended
+        for _, output := range box {
+            eng.send(output)
+        }
+    }()
 
     for {
+        // the output is only offered when there is some, a nil channel is never ready
+        var out chan *EngineOutput
+        var next *EngineOutput
+        if len(box) > 0 {
+            out, next = eng.output, box[0]
+        }
+        var cmd string
         select {
-        case cmd := <-engine_in:
-            as.CmdUpdate(cmd)
-            process_in <- cmd
-        case msg := <-process_out:
-            if as.started == false {
-                engine_out <- msg
-            } else if line := printMainline(msg, as); line != "" {
-                engine_out <- line
+        case out <- next:
+            box = box[1:]
+            continue
+        case <-flush:
+            flush = nil
+            box.push(as.flush())
+            continue
+        case cmd = <-eng.input:
+        case cmd = <-commands:
+        case msg, ok := <-client.Lines:
+            if !ok {
+                return
             }
-        case <-engine_err:
-
+            if strings.HasPrefix(msg, "bestmove") {
+                // the final lines come before the best move
+                box.push(as.flush())
+                flush = nil
+                as.started = false
+            } else if as.started && as.coalesce(msg) {
+                if flush == nil {
+                    flush = time.After(eng.config.OutputInterval())
+                }
+                continue
+            }
+            // lines without a pv, e.g. "info string" or "info currmove", are passed as they are
+            box.push(NewEngineOutput(msg, as))
+            continue
+        case <-process.Err():
             return
-        case <-process_err:
+        case <-eng.terminated:
             return
         }
+        box.push(eng.command(ctx, client, as, cmd))
     }
 }
 
-//"info depth 1 seldepth 1 multipv 1 score cp 56 nodes 33 nps 16500 tbhits 0 time 2 pv e2e3 a7a6"
-var mainlineRegex = regexp.MustCompile(`.*seldepth (?P<depth>\d+).*score (?P<score>\w+ \d+).*pv (?P<mainline>.*)$`)
-
-// TODO: AnalysisState as parameter seems wrong
-func printMainline(msg string, as *AnalysisState) string {
-    if !regexp.MustCompile(`seldepth`).MatchString(msg) {
-        return ""
+// command handles a command from the user, the reply goes back to the user.
+// "options" lists the options of the engine as json, "setoption" is validated and stored.
+// "multipv n" sets MultiPV for an analysis, it isn't stored as the choice of the user.
+func (eng *Engine) command(ctx context.Context, client *UciClient, as *AnalysisState, cmd string) *EngineOutput {
+    if match := REGEX_MULTIPV.FindStringSubmatch(cmd); match != nil {
+        if err := client.SetOption(ctx, "MultiPV", match[1]); err != nil {
+            return &EngineOutput{Raw: "error " + err.Error(), Failure: err}
+        }
+        as.CmdUpdate(cmd)
+        return nil
+    }
+    if strings.TrimSpace(cmd) == "options" {
+        options := client.OptionList()
+        bytes, err := json.Marshal(options)
+        if err != nil {
+            return &EngineOutput{Raw: "error " + err.Error(), Failure: err}
+        }
+        return &EngineOutput{Raw: "options " + string(bytes), Options: options}
+    }
+    if name, value, ok := parseSetOption(cmd); ok {
+        if err := client.SetOption(ctx, name, value); err != nil {
+            return &EngineOutput{Raw: "error " + err.Error(), Failure: err}
+        }
+        as.CmdUpdate(cmd)
+        if option := client.Option(name); option != nil && option.Type != OPTION_BUTTON && eng.options != nil {
+            if err := eng.options.Set(eng.key, option.Name, value); err != nil {
+                log.Println(err)
+            }
+        }
+        return nil
     }
-    match := mainlineRegex.FindStringSubmatch(msg)
-    result := make(map[string]string)
-    for i, name := range mainlineRegex.SubexpNames() {
-        result[name] = match[i]
+    as.CmdUpdate(cmd)
+    if err := client.Send(ctx, cmd); err != nil {
+        log.Println(err)
     }
-    eval := getEval(result["score"])
+    return nil
+}
 
-    board := NewBitBoard(as.fen)
-    prettyLine := PrettyLine(result["mainline"], board, as.MoveNumber(), as.WhiteToMove())
-    res := fmt.Sprintf("%s - %s", eval, prettyLine)
-    return res
+// EngineOutput is a line of output from the engine. Info lines are parsed,
+// all other lines (id, option, bestmove, ...) only carry the raw text.
+type EngineOutput struct {
+    Raw string
+    Info *InfoLine   // nil if the line is not an info line
+    PrettyLine string // the pv in human readable format, "" if there is no pv
+    Lines []*EngineOutput // the best lines of the search by rank, set when the line is part of a multipv search
+    Error *EngineError // set when the engine could not be started or has crashed
+    Options []*UciOption // the reply to "options"
+    Failure error // a command of the user that was rejected
 }
 
+// NewEngineOutput parses a line from the engine, a pv is printed from the analyzed position
+func NewEngineOutput(msg string, as *AnalysisState) *EngineOutput {
+    output := &EngineOutput{Raw: msg}
+    if !strings.HasPrefix(msg, "info") {
+        return output
+    }
+    info, err := ParseInfoLine(msg)
+    if err != nil {
+        log.Println(err)
+        return output
+    }
+    output.Info = info
+    if as.board == nil {
+        return output
+    }
+    // a pv that was computed for another position would make PrettyLine panic
+    pv := legalPrefix(as.board, info.PV)
+    if len(pv) < len(info.PV) {
+        log.Printf("pv %s does not fit %s", strings.Join(info.PV, " "), as.board.FEN())
+    }
+    if len(pv) > 0 {
+        board := as.board
+        output.PrettyLine = PrettyLine(strings.Join(pv, " "), board, board.MoveNumber(), board.WhiteToMove())
+    }
+    return output
+}
 
-var scoreRegex = regexp.MustCompile(`(?P<scoreType>\w+) (?P<val>\d+)`)
-func getEval(score string) string {
-    match := scoreRegex.FindStringSubmatch(score)
-    if len(match) < 2 { return "error in getEval" }
+// legalPrefix returns the moves of a line up to the first illegal move
+func legalPrefix(board *BitBoard, uciMoves []string) []string {
+    board = board.Clone()
+    for i, uciMove := range uciMoves {
+        var legal *Move
+        for _, move := range board.LegalMoves() {
+            if move.uciMove == uciMove {
+                legal = move
+            }
+        }
+        if legal == nil {
+            return uciMoves[:i]
+        }
+        board.Make(legal)
+    }
+    return uciMoves
+}
 
-    result := make(map[string]string)
-    for i, name := range scoreRegex.SubexpNames() {
-        result[name] = match[i]
+// String gives the evaluation and the pv of an info line, other lines are returned as they came.
+// With ranked lines every candidate move is printed on its own line.
+func (output *EngineOutput) String() string {
+    if len(output.Lines) > 1 {
+        return formatRankedLines(output.Lines)
     }
-    if result["scoreType"] == "mate" {
-        return fmt.Sprintf("#%s", result["val"])
-    } else if result["scoreType"] == "cp" {
-        eval, _ := strconv.ParseFloat(result["val"], 64)
-        eval = eval / 100
-        return fmt.Sprintf("%3.2f", result["val"])
-    } else {
-        panic(fmt.Sprintf("Unknown score type %s", result["scoreType"]))
+    if output.PrettyLine == "" {
+        return output.Raw
+    }
+    if output.Info.Score == nil {
+        return output.PrettyLine
+    }
+    return fmt.Sprintf("%s - %s", output.Info.Score, output.PrettyLine)
+}
+
+// TODO: AnalysisState as parameter seems wrong
+func printMainline(msg string, as *AnalysisState) string {
+    output := NewEngineOutput(msg, as)
+    if output.PrettyLine == "" {
+        return ""
     }
+    return output.String()
 }
 
 
@@ -167,27 +536,35 @@ func getEval(score string) string {
 // - Moves should be uniquely identified. I.e. with rooks on a1 and f1 write Rae1.
 //   Likewise with knights on e5 and e3 write N5c4.
 // - Castling has the symbols "0-0" and "0-0-0"
+// - A checkmate is denoted by "#". When the line ends the game the result is appended.
 func PrettyLine(line string, board *BitBoard, moveNumber int, whiteToMove bool) string {
-    // learn how to copy struct BitBoard because it is changed here
-    // board_local := Voodoo(board)
+    board = board.Clone() // the caller's board stays untouched
 
-    color := Color(whiteToMove)
     moves := []*Move{}
     for _, uciMove := range strings.Split(line, " ") {
         move := NewMove(uciMove, board)
-        board.UpdateBoard(move)
-        move.isCheck = board.isCheck(color)
+        board.Make(move)
+        move.isCheck = board.isCheck(!board.toMove)
         moves = append(moves, move)
-        color = !color
     }
 
-    fmt.Println("\n")
-    fmt.Println(line)
-    board.Pretty()
-    return styleLine(moves, moveNumber, whiteToMove, "")
+    status := board.Status()
+    if status == CHECKMATE {
+        moves[len(moves) - 1].isCheckmate = true
+    }
+    result := styleLine(moves, moveNumber, whiteToMove, "")
+    if status != ONGOING {
+        result += " " + board.Result()
+    }
+    return result
 }
 
 func styleLine(moves []*Move, moveNumber int, whiteToMove bool, result string) string {
+    return styleLineWith(styleMove, moves, moveNumber, whiteToMove, result)
+}
+
+// styleLineWith numbers the moves of a line, the moves themselves are styled by the given function
+func styleLineWith(style func(*Move) string, moves []*Move, moveNumber int, whiteToMove bool, result string) string {
     if len(moves) == 0 { return "" } // defensive programming
 
     if result != "" {
@@ -201,13 +578,13 @@ func styleLine(moves []*Move, moveNumber int, whiteToMove bool, result string) s
         result += fmt.Sprintf("%d...", moveNumber)
     }
 
-    result += styleMove(moves[0])
+    result += style(moves[0])
 
     if len(moves) == 1 {
         return result
     } else {
         if !whiteToMove { moveNumber += 1 }
-        return styleLine(moves[1:], moveNumber, !whiteToMove, result)
+        return styleLineWith(style, moves[1:], moveNumber, !whiteToMove, result)
     }
 }
 
@@ -244,7 +621,12 @@ func getPromotionString(move *Move) string {
 }
 
 func getCheckString(move *Move) string {
-    if move.isCheck { return "+" } else { return "" }
+    if move.isCheckmate {
+        return "#"
+    } else if move.isCheck {
+        return "+"
+    }
+    return ""
 }
 
 type Square struct {
@@ -267,12 +649,23 @@ func NewSquare(name string) *Square {
     return &Square{name, file, rank}
 }
 
+// NewSquareByNum returns one of the 64 precomputed squares, squares are never changed
 func NewSquareByNum(num int) *Square {
-    // TODO: unittest this
-    file_int := num % 8
-    rank_int := num / 8
-    square_str := fmt.Sprintf("%s%d", string(97 + file_int), rank_int + 1)
-    return NewSquare(square_str)
+    return SQUARES[num]
+}
+
+var SQUARES = newSquares()
+
+func newSquares() [64]*Square {
+    var squares [64]*Square
+    for num := 0; num < 64; num++ {
+        // TODO: unittest this
+        file_int := num % 8
+        rank_int := num / 8
+        square_str := fmt.Sprintf("%s%d", string(rune(97 + file_int)), rank_int + 1)
+        squares[num] = NewSquare(square_str)
+    }
+    return squares
 }
 
 func (s *Square) bit() uint64 {
@@ -313,6 +706,7 @@ type Move struct {
     promotionPiece PieceType
 
     isCheck bool
+    isCheckmate bool
 
     unambiguity string
 }
@@ -329,6 +723,7 @@ func NewMove(uciMove string, board *BitBoard) *Move {
     isPromotion     := false
     promotionPiece  := NO_PIECE
     isCheck         := false
+    isCheckmate     := false
     unambiguity     := "" // is it Nd2 or Nbd2
 
     if pieceType.is(PAWN) {
@@ -343,7 +738,12 @@ func NewMove(uciMove string, board *BitBoard) *Move {
     }
 
     return &Move{uciMove, initialSquare, targetSquare, pieceType, isCastling, castlingType,
-        isCapture, isEnPassant, enPassantSquare, isPromotion, promotionPiece, isCheck, unambiguity}
+        isCapture, isEnPassant, enPassantSquare, isPromotion, promotionPiece, isCheck, isCheckmate, unambiguity}
+}
+
+// UCI returns the move in uci notation, e.g. "e7e8q"
+func (move *Move) UCI() string {
+    return move.uciMove
 }
 
 func checkCastling(move string, pieceType PieceType) (bool, CastlingType) {
@@ -387,22 +787,12 @@ type Fen struct {
     move int
 }
 
+// NewFen is ParseFen for fens that are known to be valid, like STARTPOSITION. It panics on an invalid fen,
+// a fen from a user goes through ParseFen.
 func NewFen(s string) *Fen {
-    parts := strings.Split(s, " ")
-
-    boardString := ""
-    color := "w"
-    castling := ""
-    enpassant := ""
-    halfmoves := 0
-    move := 0
-
-    if len(parts) > 0 { boardString = parts[0] }
-    if len(parts) > 1 { color = parts[1] }
-    if len(parts) > 2 { castling = parts[2] }
-    if len(parts) > 3 { enpassant = parts[3] }
-    if len(parts) > 4 { halfmoves, _ = strconv.Atoi(parts[4]) }
-    if len(parts) > 5 { move, _ = strconv.Atoi(parts[5]) }
-
-    return &Fen{boardString, color, castling, enpassant, halfmoves, move}
+    fen, err := ParseFen(s)
+    if err != nil {
+        panic(err)
+    }
+    return fen
 }
@@ -3,7 +3,12 @@ package main
 
 import (
     //"fmt"
+    "context"
+    "io/ioutil"
+    "os"
+    "path/filepath"
     "testing"
+    "time"
     "github.com/stretchr/testify/assert"
 )
 
@@ -16,7 +21,12 @@ func TestNewFen_01(t *testing.T) {
     assert.Equal(t, f.castling, "-")
     assert.Equal(t, f.enpassant, "-")
     assert.Equal(t, f.halfmoves, 0)
-    assert.Equal(t, f.move, 0)
+    assert.Equal(t, f.move, 1)
+}
+
+func TestNewFen_02(t *testing.T) {
+    // a short row can't pass as a position
+    assert.Panics(t, func() { NewFen("rnbqkbnr/pp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1") })
 }
 
 func TestExpandRow_01(t *testing.T) {
@@ -24,3 +34,142 @@ func TestExpandRow_01(t *testing.T) {
     res := expandRow(sample)
     assert.Equal(t, res, "xxxxxkxx")
 }
+
+func TestNewEngineOutput_stale_pv_01(t *testing.T) {
+    // the engine still reports a line of the position before "position startpos moves e2e4"
+    as := NewAnalysisState(STARTPOSITION)
+    as.CmdUpdate("position startpos moves e2e4")
+    output := NewEngineOutput("info depth 20 score cp 30 pv e2e4 e7e5", as)
+    assert.Equal(t, "", output.PrettyLine)
+
+    output = NewEngineOutput("info depth 20 score cp 30 pv e7e5 e2e4", as)
+    assert.Equal(t, "1...e5", output.PrettyLine)
+}
+
+func TestCmdUpdate_position_01(t *testing.T) {
+    as := NewAnalysisState(STARTPOSITION)
+    as.CmdUpdate("position startpos moves e2e4 c7c5")
+    assert.Equal(t, "rnbqkbnr/pp1ppppp/8/2p5/4P3/8/PPPP1PPP/RNBQKBNR w KQkq c6 0 2", as.board.FEN())
+
+    as.CmdUpdate("position fen 4k3/8/8/8/8/8/4P3/4K3 w - - 0 1 moves e2e4")
+    assert.Equal(t, "4k3/8/8/8/4P3/8/8/4K3 b - e3 0 1", as.board.FEN())
+
+    // an illegal move keeps the position
+    as.CmdUpdate("position startpos moves e2e5")
+    assert.Equal(t, "4k3/8/8/8/4P3/8/8/4K3 b - e3 0 1", as.board.FEN())
+
+    fenString, moves, ok := ParsePositionCommand("position startpos")
+    assert.Equal(t, "", fenString)
+    assert.Equal(t, 0, len(moves))
+    assert.True(t, ok)
+}
+
+func TestAnalysisState_flush_01(t *testing.T) {
+    as := NewAnalysisState(STARTPOSITION)
+    as.CmdUpdate("setoption name MultiPV value 2")
+    as.CmdUpdate("go infinite")
+    assert.False(t, as.coalesce("info depth 1 currmove e2e4 currmovenumber 1"))
+    assert.True(t, as.coalesce("info depth 1 multipv 1 score cp 10 pv d2d4"))
+    assert.True(t, as.coalesce("info depth 2 multipv 1 score cp 20 pv e2e4"))
+    assert.True(t, as.coalesce("info depth 2 multipv 2 score cp 15 pv d2d4"))
+
+    // only the newest line of every slot is printed
+    update := as.flush()
+    assert.Equal(t, "1) 0.20 - 1.e4 (depth 2)\n2) 0.15 - 1.d4 (depth 2)", update.String())
+    assert.Nil(t, as.flush())
+}
+
+func TestOutbox_push_01(t *testing.T) {
+    var box outbox
+    first := &EngineOutput{Raw: "info depth 1", Lines: []*EngineOutput{}}
+    second := &EngineOutput{Raw: "info depth 2", Lines: []*EngineOutput{}}
+    bestMove := &EngineOutput{Raw: "bestmove e2e4"}
+    box.push(first)
+    box.push(second)
+    box.push(nil)
+    box.push(bestMove)
+    box.push(first)
+    assert.Equal(t, outbox{second, bestMove, first}, box)
+
+    // a full outbox drops the oldest output that isn't final
+    for i := 0; i < OUTBOX_SIZE - 2; i++ {
+        box.push(&EngineOutput{Raw: "readyok"})
+    }
+    assert.Equal(t, OUTBOX_SIZE, len(box))
+    assert.Equal(t, outbox{bestMove, first}, box[:2])
+}
+
+// CHATTY_ENGINE answers "go" with a flood of info lines and leaves a mark when all are written
+const CHATTY_ENGINE = `#!/bin/sh
+while read cmd; do
+    case "$cmd" in
+        uci) echo uciok;;
+        isready) echo readyok;;
+        go*) echo "info string searching"; for i in $(seq 1 20000); do echo "info depth $i score cp $i pv e2e4"; done; touch "$1"; echo "bestmove e2e4";;
+        quit) exit 0;;
+    esac
+done
+`
+
+func TestTalk_coalesce_01(t *testing.T) {
+    dir := t.TempDir()
+    path, mark := filepath.Join(dir, "chatty-engine"), filepath.Join(dir, "written")
+    assert.Nil(t, ioutil.WriteFile(path, []byte(CHATTY_ENGINE), 0755))
+    eng := NewEngine(&EngineConfig{Name: "chatty", Path: path, Args: []string{mark}, OutputIntervalMs: 50})
+    eng.Start(context.Background())
+    defer eng.Terminate()
+    for output := range eng.Output() {
+        if output.Raw == "readyok" {
+            break
+        }
+    }
+    eng.Input() <- "go infinite"
+
+    // nobody reads the output, the engine writes all its lines anyway
+    deadline := time.Now().Add(5 * time.Second)
+    for {
+        if _, err := os.Stat(mark); err == nil {
+            break
+        }
+        if time.Now().After(deadline) {
+            t.Fatal("the engine is stuck writing its output")
+        }
+        time.Sleep(10 * time.Millisecond)
+    }
+
+    updates := []*EngineOutput{}
+    for output := range eng.Output() {
+        if output.Raw == "bestmove e2e4" {
+            break
+        }
+        updates = append(updates, output)
+    }
+    assert.True(t, len(updates) < 100, "%d updates", len(updates))
+    // a line without a pv isn't coalesced
+    assert.Equal(t, "info string searching", updates[0].Raw)
+    assert.Equal(t, 20000, updates[len(updates) - 1].Info.Depth)
+}
+
+func TestEngine_multipv_01(t *testing.T) {
+    // the multipv of an analysis is used for the search, only setoption is stored
+    store, err := LoadOptionStore(filepath.Join(t.TempDir(), "options.json"))
+    assert.Nil(t, err)
+    eng := NewEngine(fakeEngineConfig(t, "fake", "0"))
+    eng.options = store
+    eng.Start(context.Background())
+    defer eng.Terminate()
+    readUntilRaw := func(raw string) {
+        for output := range eng.Output() {
+            if output.Raw == raw {
+                return
+            }
+        }
+    }
+    readUntilRaw("readyok")
+
+    eng.Input() <- "multipv 3"
+    eng.Input() <- "setoption name Hash value 32"
+    eng.Input() <- "isready"
+    readUntilRaw("readyok")
+    assert.Equal(t, map[string]string{"Hash": "32"}, store.Values(eng.key))
+}
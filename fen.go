@@ -0,0 +1,204 @@
+package main
+
+
+import (
+    "fmt"
+    "regexp"
+    "strconv"
+    "strings"
+)
+
+// FenError reports which part of a FEN string is invalid
+type FenError struct {
+    Fen string
+    Field string // one of the FEN_FIELD_* constants
+    Reason string
+}
+
+const FEN_FIELD_COUNT = "fields"
+const FEN_FIELD_BOARD = "board"
+const FEN_FIELD_COLOR = "color"
+const FEN_FIELD_CASTLING = "castling"
+const FEN_FIELD_ENPASSANT = "en passant"
+const FEN_FIELD_HALFMOVES = "halfmoves"
+const FEN_FIELD_MOVE = "move"
+
+func (e *FenError) Error() string {
+    return fmt.Sprintf("invalid fen '%s': %s: %s", e.Fen, e.Field, e.Reason)
+}
+
+// String returns the FEN string, missing fields are filled with their defaults
+func (f *Fen) String() string {
+    castling := f.castling
+    if castling == "" { castling = "-" }
+    enpassant := f.enpassant
+    if enpassant == "" { enpassant = "-" }
+    move := f.move
+    if move < 1 { move = 1 }
+
+    return fmt.Sprintf("%s %s %s %s %d %d", f.boardString, f.color, castling, enpassant, f.halfmoves, move)
+}
+
+var FEN_ROW_REGEX = regexp.MustCompile(`^[KQRBNPkqrbnp1-8]+$`)
+var FEN_CASTLING_REGEX = regexp.MustCompile(`^(-|K?Q?k?q?)$`)
+var FEN_ENPASSANT_REGEX = regexp.MustCompile(`^(-|[a-h][36])$`)
+var FEN_DIGITS_REGEX = regexp.MustCompile(`\d\d`)
+
+// ParseFen parses a FEN string, it returns a *FenError for malformed input.
+// The move counters may be omitted.
+func ParseFen(s string) (*Fen, error) {
+    fail := func(field, reason string, args ...interface{}) (*Fen, error) {
+        return nil, &FenError{s, field, fmt.Sprintf(reason, args...)}
+    }
+
+    parts := strings.Fields(s)
+    if len(parts) < 4 || len(parts) > 6 {
+        return fail(FEN_FIELD_COUNT, "expected 4 to 6 fields, got %d", len(parts))
+    }
+
+    rows := strings.Split(parts[0], "/")
+    if len(rows) != 8 {
+        return fail(FEN_FIELD_BOARD, "expected 8 rows, got %d", len(rows))
+    }
+    for i, row := range rows {
+        if !FEN_ROW_REGEX.MatchString(row) {
+            return fail(FEN_FIELD_BOARD, "row %d '%s' contains invalid characters", i + 1, row)
+        }
+        if FEN_DIGITS_REGEX.MatchString(row) {
+            return fail(FEN_FIELD_BOARD, "row %d '%s' has consecutive digits", i + 1, row)
+        }
+        if len(expandRow(row)) != 8 {
+            return fail(FEN_FIELD_BOARD, "row %d '%s' does not have 8 squares", i + 1, row)
+        }
+    }
+
+    color := parts[1]
+    if color != "w" && color != "b" {
+        return fail(FEN_FIELD_COLOR, "expected 'w' or 'b', got '%s'", color)
+    }
+
+    castling := parts[2]
+    if castling == "" || !FEN_CASTLING_REGEX.MatchString(castling) {
+        return fail(FEN_FIELD_CASTLING, "'%s' is not '-' or a subset of 'KQkq'", castling)
+    }
+
+    enpassant := parts[3]
+    if !FEN_ENPASSANT_REGEX.MatchString(enpassant) {
+        return fail(FEN_FIELD_ENPASSANT, "'%s' is not '-' or a square on the 3rd or 6th rank", enpassant)
+    }
+
+    halfmoves := 0
+    if len(parts) > 4 {
+        var err error
+        halfmoves, err = strconv.Atoi(parts[4])
+        if err != nil || halfmoves < 0 {
+            return fail(FEN_FIELD_HALFMOVES, "'%s' is not a number >= 0", parts[4])
+        }
+    }
+
+    move := 1
+    if len(parts) > 5 {
+        var err error
+        move, err = strconv.Atoi(parts[5])
+        if err != nil || move < 1 {
+            return fail(FEN_FIELD_MOVE, "'%s' is not a number >= 1", parts[5])
+        }
+    }
+
+    f := &Fen{parts[0], color, castling, enpassant, halfmoves, move}
+    if field, reason := NewBitBoard(f).validate(); field != "" {
+        return fail(field, reason)
+    }
+    return f, nil
+}
+
+// validate checks a board for positions that can't occur in a game.
+// It returns the FEN field and the reason of the first problem found.
+func (board *BitBoard) validate() (string, string) {
+    for _, king := range []PieceType{WHITE_KING, BLACK_KING} {
+        if count := len(findBitPositions(board.layers[king])); count != 1 {
+            return FEN_FIELD_BOARD, fmt.Sprintf("expected one '%s', got %d", PIECE_TO_FEN[king], count)
+        }
+    }
+
+    pawns := board.layers[WHITE_PAWN] | board.layers[BLACK_PAWN]
+    if pawns & (Rank1BB | Rank8BB) != 0 {
+        return FEN_FIELD_BOARD, "pawns on the first or last rank"
+    }
+
+    if board.isCheck(board.toMove) {
+        return FEN_FIELD_COLOR, "the side not to move is in check"
+    }
+
+    for castlingType, castling := range CASTLING_MOVES {
+        if !board.castlingRights.has(castlingType) { continue }
+        if board.layers[castling.kingType] & castling.king == 0 || board.layers[castling.rookType] & castling.rook == 0 {
+            return FEN_FIELD_CASTLING, fmt.Sprintf("king or rook are not in place for %s", castlingRightsString(castlingType.right()))
+        }
+    }
+
+    if board.enPassant != 0 {
+        // the pawn that made the double step went across the en passant square
+        pawnType, pawn, rank := PieceType(WHITE_PAWN), shift(board.enPassant, DELTA_N), uint64(Rank3BB)
+        if board.toMove == WHITE {
+            pawnType, pawn, rank = BLACK_PAWN, shift(board.enPassant, DELTA_S), Rank6BB
+        }
+        if board.enPassant & rank == 0 || board.layers[pawnType] & pawn == 0 {
+            return FEN_FIELD_ENPASSANT, "no pawn made a double step to this square"
+        }
+    }
+    return "", ""
+}
+
+// FEN returns the complete position in Forsyth-Edwards Notation
+func (board *BitBoard) FEN() string {
+    rows := []string{}
+    for r := 7; r >= 0; r-- {
+        row := ""
+        empty := 0
+        for f := 0; f < 8; f++ {
+            pieceType := board.GetPiece(NewSquareByNum(8 * r + f))
+            if pieceType == NO_PIECE {
+                empty++
+                continue
+            }
+            if empty > 0 {
+                row += strconv.Itoa(empty)
+                empty = 0
+            }
+            row += PIECE_TO_FEN[pieceType]
+        }
+        if empty > 0 {
+            row += strconv.Itoa(empty)
+        }
+        rows = append(rows, row)
+    }
+
+    color := "w"
+    if board.toMove == BLACK {
+        color = "b"
+    }
+
+    enpassant := "-"
+    if board.enPassant != 0 {
+        enpassant = squareName(findBitPositions(board.enPassant)[0])
+    }
+
+    f := &Fen{strings.Join(rows, "/"), color, castlingRightsString(board.castlingRights),
+        enpassant, board.halfmoveClock, board.fullmoveNumber}
+    return f.String()
+}
+
+// castlingRightsString returns the castling rights in the order "KQkq", or "-"
+func castlingRightsString(rights CastlingRights) string {
+    result := ""
+    for _, symbol := range []string{"K", "Q", "k", "q"} {
+        if rights.has(FEN_TO_CASTLING[symbol]) {
+            result += symbol
+        }
+    }
+    if result == "" {
+        return "-"
+    }
+    return result
+}
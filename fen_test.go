@@ -0,0 +1,72 @@
+package main
+
+
+import (
+    "testing"
+    "github.com/stretchr/testify/assert"
+)
+
+func TestFEN_01(t *testing.T) {
+    // round trip
+    fenStrings := []string{
+        STARTPOSITION,
+        "r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R w KQkq - 0 1",
+        "rnbqkbnr/ppp1p1pp/8/3pPp2/8/8/PPPP1PPP/RNBQKBNR w Kq f6 0 3",
+        "8/2p5/3p4/KP5r/1R3p1k/8/4P1P1/8 b - - 17 42",
+    }
+    for _, fenString := range fenStrings {
+        assert.Equal(t, fenString, NewBitBoard(NewFen(fenString)).FEN())
+        assert.Equal(t, fenString, NewFen(fenString).String())
+    }
+}
+
+func TestFEN_02(t *testing.T) {
+    // position after some moves
+    board := NewBitBoardStart()
+    playMoves(board, "e2e4")
+    assert.Equal(t, "rnbqkbnr/pppppppp/8/8/4P3/8/PPPP1PPP/RNBQKBNR b KQkq e3 0 1", board.FEN())
+
+    playMoves(board, "g8f6", "e1e2")
+    assert.Equal(t, "rnbqkb1r/pppppppp/5n2/8/4P3/8/PPPPKPPP/RNBQ1BNR b kq - 2 2", board.FEN())
+}
+
+func TestFenString_01(t *testing.T) {
+    // defaults for the missing move counters
+    f := NewFen("5k2/4n2p/1q2PBp1/p7/Q4P2/6P1/7P/2rR3K b - -")
+    assert.Equal(t, "5k2/4n2p/1q2PBp1/p7/Q4P2/6P1/7P/2rR3K b - - 0 1", f.String())
+}
+
+func TestParseFen_01(t *testing.T) {
+    f, err := ParseFen("5k2/4n2p/1q2PBp1/p7/Q4P2/6P1/7P/2rR3K b - -")
+    assert.Nil(t, err)
+    assert.Equal(t, "b", f.color)
+    assert.Equal(t, 1, f.move)
+}
+
+func TestParseFen_02(t *testing.T) {
+    invalid := map[string]string{
+        "rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq":          FEN_FIELD_COUNT,
+        "rnbqkbnr/pppppppp/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1":       FEN_FIELD_BOARD,
+        "rnbqkbnr/pppppppp/9/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1":     FEN_FIELD_BOARD,
+        "rnbqkbnr/pppppppp/44/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1":    FEN_FIELD_BOARD,
+        "rnbqkbnr/ppppxppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1":     FEN_FIELD_BOARD,
+        "rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQQBNR w KQkq - 0 1":     FEN_FIELD_BOARD,
+        "rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBKKBNR w KQkq - 0 1":     FEN_FIELD_BOARD,
+        "rnbqkbnP/pppppppp/8/8/8/8/PPPPPPP1/RNBQKBNR w KQq - 0 1":      FEN_FIELD_BOARD,
+        "rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR x KQkq - 0 1":     FEN_FIELD_COLOR,
+        "rnbqkbnr/ppppp1pp/8/5p1Q/4P3/8/PPPP1PPP/RNB1KBNR w KQkq - 0 1": FEN_FIELD_COLOR,
+        "rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkX - 0 1":     FEN_FIELD_CASTLING,
+        "rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w qkQK - 0 1":     FEN_FIELD_CASTLING,
+        "rnbqkbn1/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1":     FEN_FIELD_CASTLING,
+        "rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq e4 0 1":    FEN_FIELD_ENPASSANT,
+        "rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq e6 0 1":    FEN_FIELD_ENPASSANT,
+        "rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - -1 1":    FEN_FIELD_HALFMOVES,
+        "rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 0":     FEN_FIELD_MOVE,
+    }
+    for fenString, field := range invalid {
+        _, err := ParseFen(fenString)
+        if assert.IsType(t, &FenError{}, err, fenString) {
+            assert.Equal(t, field, err.(*FenError).Field, fenString)
+        }
+    }
+}
@@ -0,0 +1,179 @@
+package main
+
+
+import (
+    "fmt"
+    "regexp"
+    "strconv"
+    "strings"
+)
+
+// InfoLine holds everything an engine reports with the uci "info" command.
+// Numbers that the engine did not send are 0, lists are empty.
+type InfoLine struct {
+    Depth int
+    SelDepth int
+    Time int // milliseconds
+    Nodes int64
+    PV []string // uci moves
+    MultiPV int
+    Score *Score // from the point of view of the side to move, nil if there is no score
+    WDL *WDL
+    CurrMove string
+    CurrMoveNumber int
+    HashFull int // permill
+    NPS int64
+    TBHits int64
+    SBHits int64
+    CPULoad int // permill
+    String string
+    Refutation []string
+    CurrLine []string
+    CurrLineCPU int
+}
+
+// WDL are the chances for win, draw and loss of the side to move in permill
+type WDL struct {
+    Win int
+    Draw int
+    Loss int
+}
+
+// Rank is the number of the line in multipv mode, 1 for the best line
+func (info *InfoLine) Rank() int {
+    if info.MultiPV < 1 {
+        return 1
+    }
+    return info.MultiPV
+}
+
+var UCI_MOVE_REGEX = regexp.MustCompile(`^([a-h][1-8][a-h][1-8][qrbn]?|0000)$`)
+
+// ParseInfoLine reads an "info" line from a uci engine.
+// Unknown keywords are skipped, malformed values are reported as errors.
+func ParseInfoLine(line string) (*InfoLine, error) {
+    tokens := strings.Fields(line)
+    if len(tokens) == 0 || tokens[0] != "info" {
+        return nil, fmt.Errorf("info: not an info line '%s'", line)
+    }
+
+    info := &InfoLine{}
+    i := 1
+    // value returns the token after the keyword
+    value := func() (string, error) {
+        if i + 1 >= len(tokens) {
+            return "", fmt.Errorf("info: missing value for '%s' in '%s'", tokens[i], line)
+        }
+        i++
+        return tokens[i], nil
+    }
+    number := func() (int64, error) {
+        keyword := tokens[i]
+        s, err := value()
+        if err != nil {
+            return 0, err
+        }
+        n, err := strconv.ParseInt(s, 10, 64)
+        if err != nil {
+            return 0, fmt.Errorf("info: '%s' is not a number for '%s' in '%s'", s, keyword, line)
+        }
+        return n, nil
+    }
+    moves := func() []string {
+        result := []string{}
+        for i + 1 < len(tokens) && UCI_MOVE_REGEX.MatchString(tokens[i + 1]) {
+            i++
+            result = append(result, tokens[i])
+        }
+        return result
+    }
+
+    for ; i < len(tokens); i++ {
+        var err error
+        var n int64
+        switch tokens[i] {
+        case "depth":
+            n, err = number()
+            info.Depth = int(n)
+        case "seldepth":
+            n, err = number()
+            info.SelDepth = int(n)
+        case "time":
+            n, err = number()
+            info.Time = int(n)
+        case "nodes":
+            info.Nodes, err = number()
+        case "multipv":
+            n, err = number()
+            info.MultiPV = int(n)
+        case "currmovenumber":
+            n, err = number()
+            info.CurrMoveNumber = int(n)
+        case "hashfull":
+            n, err = number()
+            info.HashFull = int(n)
+        case "nps":
+            info.NPS, err = number()
+        case "tbhits":
+            info.TBHits, err = number()
+        case "sbhits":
+            info.SBHits, err = number()
+        case "cpuload":
+            n, err = number()
+            info.CPULoad = int(n)
+        case "currmove":
+            info.CurrMove, err = value()
+        case "pv":
+            info.PV = moves()
+        case "refutation":
+            info.Refutation = moves()
+        case "currline":
+            if i + 1 < len(tokens) && !UCI_MOVE_REGEX.MatchString(tokens[i + 1]) {
+                n, err = number()
+                info.CurrLineCPU = int(n)
+            }
+            info.CurrLine = moves()
+        case "string":
+            info.String = strings.Join(tokens[i + 1:], " ")
+            i = len(tokens)
+        case "score":
+            info.Score = &Score{}
+            err = parseInfoScore(tokens, &i, info.Score, number)
+        case "wdl":
+            wdl := [3]int64{}
+            for j := 0; j < 3 && err == nil; j++ {
+                wdl[j], err = number()
+            }
+            info.WDL = &WDL{int(wdl[0]), int(wdl[1]), int(wdl[2])}
+        }
+        if err != nil {
+            return nil, err
+        }
+    }
+    return info, nil
+}
+
+// parseInfoScore reads "cp <x>" or "mate <y>", optionally followed by "lowerbound" or "upperbound"
+func parseInfoScore(tokens []string, i *int, score *Score, number func() (int64, error)) error {
+    for *i + 1 < len(tokens) {
+        switch tokens[*i + 1] {
+        case "cp", "mate":
+            *i++
+            score.Mate = tokens[*i] == "mate"
+            n, err := number()
+            if err != nil {
+                return err
+            }
+            score.Value = int(n)
+        case "lowerbound":
+            *i++
+            score.Bound = LOWER_BOUND
+        case "upperbound":
+            *i++
+            score.Bound = UPPER_BOUND
+        default:
+            return nil
+        }
+    }
+    return nil
+}
@@ -0,0 +1,81 @@
+package main
+
+
+import (
+    "testing"
+    "github.com/stretchr/testify/assert"
+)
+
+func TestParseInfoLine_01(t *testing.T) {
+    line := "info depth 11 seldepth 8 multipv 2 score cp -45 nodes 2530 nps 253000 hashfull 12 tbhits 3 time 10 pv e2e4 e7e5 g1f3"
+    info, err := ParseInfoLine(line)
+    assert.Nil(t, err)
+    assert.Equal(t, 11, info.Depth)
+    assert.Equal(t, 8, info.SelDepth)
+    assert.Equal(t, 2, info.MultiPV)
+    assert.Equal(t, 2, info.Rank())
+    assert.Equal(t, &Score{Value: -45}, info.Score)
+    assert.Equal(t, int64(2530), info.Nodes)
+    assert.Equal(t, int64(253000), info.NPS)
+    assert.Equal(t, 12, info.HashFull)
+    assert.Equal(t, int64(3), info.TBHits)
+    assert.Equal(t, 10, info.Time)
+    assert.Equal(t, []string{"e2e4", "e7e5", "g1f3"}, info.PV)
+}
+
+func TestParseInfoLine_score_01(t *testing.T) {
+    info, _ := ParseInfoLine("info depth 20 score mate -3 pv e1e2")
+    assert.Equal(t, &Score{Mate: true, Value: -3}, info.Score)
+    assert.Equal(t, "#-3", info.Score.String())
+    assert.Equal(t, 1, info.Rank())
+
+    info, _ = ParseInfoLine("info depth 20 score cp 13 lowerbound nodes 100")
+    assert.Equal(t, &Score{Value: 13, Bound: LOWER_BOUND}, info.Score)
+    assert.Equal(t, int64(100), info.Nodes)
+
+    info, _ = ParseInfoLine("info depth 20 score cp 13 upperbound wdl 250 700 50")
+    assert.Equal(t, UPPER_BOUND, info.Score.Bound)
+    assert.Equal(t, &WDL{250, 700, 50}, info.WDL)
+}
+
+func TestParseInfoLine_02(t *testing.T) {
+    info, _ := ParseInfoLine("info currmove e2e4 currmovenumber 1 cpuload 950")
+    assert.Equal(t, "e2e4", info.CurrMove)
+    assert.Equal(t, 1, info.CurrMoveNumber)
+    assert.Equal(t, 950, info.CPULoad)
+    assert.Nil(t, info.Score)
+
+    info, _ = ParseInfoLine("info refutation d1h5 g6h5 currline 1 e2e4 e7e5")
+    assert.Equal(t, []string{"d1h5", "g6h5"}, info.Refutation)
+    assert.Equal(t, 1, info.CurrLineCPU)
+    assert.Equal(t, []string{"e2e4", "e7e5"}, info.CurrLine)
+
+    info, _ = ParseInfoLine("info string NNUE evaluation using nn-62ef826d1a6d.nnue enabled")
+    assert.Equal(t, "NNUE evaluation using nn-62ef826d1a6d.nnue enabled", info.String)
+}
+
+func TestParseInfoLine_error_01(t *testing.T) {
+    _, err := ParseInfoLine("info depth x")
+    assert.NotNil(t, err)
+    _, err = ParseInfoLine("info score cp")
+    assert.NotNil(t, err)
+    _, err = ParseInfoLine("bestmove e2e4")
+    assert.NotNil(t, err)
+}
+
+func TestScore_ForWhite_01(t *testing.T) {
+    score := &Score{Value: 45, Bound: LOWER_BOUND}
+    assert.Equal(t, score, score.ForWhite(true))
+    assert.Equal(t, &Score{Value: -45, Bound: UPPER_BOUND}, score.ForWhite(false))
+}
+
+func TestNewEngineOutput_01(t *testing.T) {
+    as := NewAnalysisState(STARTPOSITION)
+    output := NewEngineOutput("info depth 5 score cp -20 pv e2e4 e7e5", as)
+    assert.Equal(t, "1.e4 e5", output.PrettyLine)
+    assert.Equal(t, "-0.20 - 1.e4 e5", output.String())
+
+    output = NewEngineOutput("bestmove e2e4 ponder e7e5", as)
+    assert.Nil(t, output.Info)
+    assert.Equal(t, "bestmove e2e4 ponder e7e5", output.String())
+}
@@ -1,78 +1,159 @@
 package main
 
 import (
-    //"fmt"
+    "context"
+    "encoding/json"
+    "fmt"
     "github.com/gorilla/websocket"
     "log"
+    "net"
     "net/http"
     "os"
+    "os/signal"
+    "sync"
+    "syscall"
 )
 
+// Wire is the side of a session that steers the engines, e.g. the websocket of a browser.
+// Done is closed when the wire has ended, after that nobody reads Output or writes Input anymore.
 type Wire interface {
-    Output() chan string
-    Input() chan string
-    Err() chan bool
-    Start()
-    Terminate()
+    Output() chan<- string
+    Input() <-chan string
+    Done() <-chan struct{}
+    Start(ctx context.Context) // the wire ends when ctx is done
+    Terminate() // ends the wire and waits for its goroutines
 }
 
-//func NewWire() Wire {
-//    return &Wire{
-//        output:     make(chan string),
-//        input:      make(chan string),
-//        err:        make(chan bool),
-//    }
-//}
-
-func directedPlug(w1, w2 Wire) {
-    // from source to consumer
-    // the engine is the source of data
-    // the socket steers the engine by command
-    // need a good name
-    // w1 = engine, w2 = socket
-    w1.Start()
-    w2.Start()
-    defer w1.Terminate()
-    defer w2.Terminate()
+// sendWire passes a message to the wire, false if the wire or the context has ended
+func sendWire(ctx context.Context, w Wire, msg string) bool {
+    select {
+    case w.Output() <- msg:
+        return true
+    case <-w.Done():
+        return false
+    case <-ctx.Done():
+        return false
+    }
+}
 
-    for {
-        select {
-        case msg := <-w1.Output():
-            log.Println(msg)
-            w2.Output() <- msg
+// multiPlug lets one socket drive several engines on the same position.
+// The socket speaks the json protocol, see Envelope. A message goes to every engine
+// unless it names one, the messages of the engines carry their name.
+// It returns when ctx is done, the wire ends or all engines are given up,
+// by then the engines, the wire and all goroutines of the session have ended.
+func multiPlug(ctx context.Context, engines []*Engine, w Wire) {
+    // a private session is a room without a name and with a single member
+    room := NewRoom("", engines)
+    room.Start(ctx)
+    w.Start(ctx)
+    room.Join(w, false)
+    <-room.Done()
+}
 
-        case msg := <-w2.Input():
-            log.Println(msg)
-            w1.Input() <- msg
+var upgrader = &websocket.Upgrader{ReadBufferSize: 1024, WriteBufferSize: 1024}
 
-        case <-w1.Err():
-            return
-        case <-w2.Err():
+// socketHandler connects a websocket to the engines given by the parameter "engine",
+// e.g. /socket?engine=lc0 or /socket?engine=stockfish&engine=lc0 to compare two engines.
+// With the parameter "room" the socket joins a shared room, e.g. /socket?room=sunday,
+// the engines are only chosen by the one who opens the room.
+// A dropped socket resumes its session with the parameter "session", e.g. /socket?session=3f2a...
+func socketHandler(registry *EngineRegistry, rooms *Rooms) http.HandlerFunc {
+    return func(w http.ResponseWriter, r *http.Request) {
+        names := r.URL.Query()["engine"]
+        if len(names) == 0 {
+            names = []string{""}
+        }
+        configs := []*EngineConfig{}
+        chosen := map[string]bool{}
+        for _, name := range names {
+            config, err := registry.Engine(name)
+            if err != nil {
+                http.Error(w, err.Error(), http.StatusNotFound)
+                return
+            }
+            if chosen[config.Name] {
+                http.Error(w, fmt.Sprintf("engine '%s' is chosen twice", config.Name), http.StatusBadRequest)
+                return
+            }
+            chosen[config.Name] = true
+            configs = append(configs, config)
+        }
+        conn, err := upgrader.Upgrade(w, r, nil)
+        if err != nil {
             return
         }
+        sessions.Add(1)
+        defer sessions.Done()
+        soc := NewSocket(conn)
+        newEngines := func() []*Engine {
+            engines := []*Engine{}
+            for _, config := range configs {
+                engines = append(engines, NewEngine(config))
+            }
+            return engines
+        }
+        soc.Start(r.Context())
+        rooms.Join(r.URL.Query().Get("room"), r.URL.Query().Get("session"), newEngines, soc)
     }
 }
 
-var upgrader = &websocket.Upgrader{ReadBufferSize: 1024, WriteBufferSize: 1024}
+// sessions counts the open websockets, on shutdown they are given time to say goodbye
+var sessions sync.WaitGroup
+
+// enginesHandler lists the engines a client can choose from
+func enginesHandler(registry *EngineRegistry) http.HandlerFunc {
+    return func(w http.ResponseWriter, r *http.Request) {
+        w.Header().Set("Content-Type", "application/json")
+        json.NewEncoder(w).Encode(map[string]interface{}{
+            "default": registry.Default,
+            "engines": registry.Names(),
+        })
+    }
+}
 
-func socketHandler(w http.ResponseWriter, r *http.Request) {
-    conn, err := upgrader.Upgrade(w, r, nil)
+// loadEngines reads the engine config from $HARPA_ENGINES or engines.json, without a config only stockfish is known
+func loadEngines() *EngineRegistry {
+    path := os.Getenv("HARPA_ENGINES")
+    if path == "" {
+        path = ENGINES_FILE
+    }
+    registry, err := LoadEngineRegistry(path)
+    if os.IsNotExist(err) {
+        return DefaultEngineRegistry()
+    }
     if err != nil {
-        return
+        log.Fatal(err)
     }
-    soc := NewSocket(conn)
-    eng := NewEngine("stockfish")
-    directedPlug(eng, soc)
+    return registry
 }
 
 func HarpaChess() {
+    registry := loadEngines()
+
+    // the sessions get their context from the server, an interrupt ends them all
+    ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+    defer stop()
+
     http.Handle("/", http.FileServer(http.Dir(".")))
-    http.HandleFunc("/socket", socketHandler)
+    rooms := NewRooms(ctx)
+    http.HandleFunc("/socket", socketHandler(registry, rooms))
+    http.HandleFunc("/engines", enginesHandler(registry))
+    slots := newEngineSlots(MAX_HTTP_ENGINES)
+    http.HandleFunc("/analyze", analyzeHandler(registry, slots))
+    http.HandleFunc("/analyze/stream", analyzeStreamHandler(registry, slots))
+    server := &http.Server{Addr: ":6400", BaseContext: func(net.Listener) context.Context { return ctx }}
+    go func() {
+        <-ctx.Done()
+        server.Shutdown(context.Background())
+    }()
 
     log.Println("serving")
-    if err := http.ListenAndServe(":6400", nil); err != nil {
+    if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
         log.Fatal("ListenAndServe:", err)
     }
+    sessions.Wait()
+    rooms.Wait()
+    log.Println("all engines have quit")
 }
 
 func main() {
@@ -80,6 +161,12 @@ func main() {
     // just for testing; remove this
     if len(args) > 0 && args[0] == "bitboard" {
         BitMain()
+    } else if len(args) > 0 && args[0] == "perft" {
+        PerftMain(args[1:])
+    } else if len(args) > 0 && args[0] == "annotate" {
+        AnnotateMain(args[1:])
+    } else if len(args) > 0 && args[0] == "report" {
+        ReportMain(args[1:])
     } else {
         HarpaChess()
     }
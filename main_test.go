@@ -0,0 +1,259 @@
+package main
+
+
+import (
+    "context"
+    "io/ioutil"
+    "net/http/httptest"
+    "path/filepath"
+    "runtime"
+    "sort"
+    "strings"
+    "testing"
+    "time"
+    "github.com/gorilla/websocket"
+    "github.com/stretchr/testify/assert"
+)
+
+// FAKE_ENGINE is a shell script that answers like a very fast uci engine
+const FAKE_ENGINE = `#!/bin/sh
+while read cmd; do
+    case "$cmd" in
+        uci) echo "id name $1"; echo "option name Hash type spin default 16 min 1 max 1024"
+            echo "option name MultiPV type spin default 1 min 1 max 500"; echo uciok;;
+        isready) echo readyok;;
+        go*) echo "info depth 1 score cp $2 pv e2e4"; echo "bestmove e2e4";;
+        position*) echo "info string $cmd";;
+        crash) echo "boom" >&2; kill -SEGV $$;;
+        quit) exit 0;;
+    esac
+done
+`
+
+// fakeEngineConfig writes the fake engine to a temporary directory, it reports the score cp
+func fakeEngineConfig(t *testing.T, name string, cp string) *EngineConfig {
+    path := filepath.Join(t.TempDir(), "fake-engine")
+    assert.Nil(t, ioutil.WriteFile(path, []byte(FAKE_ENGINE), 0755))
+    return &EngineConfig{Name: name, Path: path, Args: []string{name, cp}}
+}
+
+// fakeWire stands in for the websocket, closing done ends it
+type fakeWire struct {
+    output chan string
+    input chan string
+    done chan struct{}
+}
+
+func newFakeWire() *fakeWire {
+    return &fakeWire{make(chan string), make(chan string), make(chan struct{})}
+}
+
+func (w *fakeWire) Output() chan<- string { return w.output }
+func (w *fakeWire) Input() <-chan string { return w.input }
+func (w *fakeWire) Done() <-chan struct{} { return w.done }
+func (w *fakeWire) Start(ctx context.Context) {}
+func (w *fakeWire) Terminate() {}
+
+// readUntil collects the messages on the wire until one contains text
+func readUntil(t *testing.T, w *fakeWire, text string) []string {
+    messages := []string{}
+    timeout := time.After(5 * time.Second)
+    for {
+        select {
+        case msg := <-w.output:
+            messages = append(messages, msg)
+            if strings.Contains(msg, text) {
+                return messages
+            }
+        case <-timeout:
+            t.Fatalf("'%s' not received, got %v", text, messages)
+        }
+    }
+}
+
+func TestMultiPlug_01(t *testing.T) {
+    engines := []*Engine{
+        NewEngine(fakeEngineConfig(t, "one", "20")),
+        NewEngine(fakeEngineConfig(t, "two", "-35")),
+    }
+    w := newFakeWire()
+    done := make(chan bool)
+    go func() {
+        multiPlug(context.Background(), engines, w)
+        done <- true
+    }()
+
+    // both engines introduce themselves
+    messages := append(readUntil(t, w, "readyok"), readUntil(t, w, "readyok")...)
+    assert.Contains(t, messages, `{"v":1,"type":"uci","engine":"one","payload":{"line":"id name one"}}`)
+    assert.Contains(t, messages, `{"v":1,"type":"uci","engine":"two","payload":{"line":"id name two"}}`)
+
+    w.input <- `{"v":1,"type":"analyze","payload":{"depth":1}}`
+    messages = append(readUntil(t, w, "bestMove"), readUntil(t, w, "bestMove")...)
+    sort.Strings(messages)
+    assert.Equal(t, []string{
+        `{"v":1,"type":"analysisUpdate","engine":"one","payload":{"depth":1,"lines":[{"rank":1,"depth":1,"score":{"cp":20},"pv":["e2e4"],"san":"1.e4"}]}}`,
+        `{"v":1,"type":"analysisUpdate","engine":"two","payload":{"depth":1,"lines":[{"rank":1,"depth":1,"score":{"cp":-35},"pv":["e2e4"],"san":"1.e4"}]}}`,
+        `{"v":1,"type":"bestMove","engine":"one","payload":{"move":"e2e4"}}`,
+        `{"v":1,"type":"bestMove","engine":"two","payload":{"move":"e2e4"}}`,
+    }, messages)
+
+    // a message for one engine only
+    w.input <- `{"v":1,"type":"analyze","engine":"two","payload":{"depth":1}}`
+    messages = readUntil(t, w, "bestMove")
+    assert.Equal(t, 2, len(messages))
+    assert.Contains(t, messages[1], `"engine":"two"`)
+
+    w.input <- `{"v":1,"type":"stop","id":"3","engine":"three"}`
+    assert.Equal(t, []string{`{"v":1,"type":"error","id":"3","engine":"three","payload":{"message":"unknown engine 'three'"}}`},
+        readUntil(t, w, "error"))
+
+    close(w.done)
+    <-done
+}
+
+// waitGoroutines waits until no more goroutines run than before the test
+func waitGoroutines(t *testing.T, before int) {
+    deadline := time.Now().Add(5 * time.Second)
+    for runtime.NumGoroutine() > before {
+        if time.Now().After(deadline) {
+            stacks := make([]byte, 1 << 16)
+            stacks = stacks[:runtime.Stack(stacks, true)]
+            t.Fatalf("%d goroutines leaked:\n%s", runtime.NumGoroutine() - before, stacks)
+        }
+        time.Sleep(10 * time.Millisecond)
+    }
+}
+
+// dialFakeEngine serves the fake engine on a websocket and connects to it
+func dialFakeEngine(t *testing.T) (*httptest.Server, *websocket.Conn) {
+    registry := &EngineRegistry{Engines: []*EngineConfig{fakeEngineConfig(t, "fake", "0")}}
+    rooms := NewRooms(context.Background())
+    rooms.grace = 0 // the engine quits with the socket
+    server := httptest.NewServer(socketHandler(registry, rooms))
+    conn, _, err := websocket.DefaultDialer.Dial("ws" + strings.TrimPrefix(server.URL, "http"), nil)
+    assert.Nil(t, err)
+    return server, conn
+}
+
+// readSocketUntil reads messages from the socket until one contains text
+func readSocketUntil(t *testing.T, conn *websocket.Conn, text string) {
+    conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+    for {
+        _, bytes, err := conn.ReadMessage()
+        if err != nil {
+            t.Fatalf("'%s' not received: %s", text, err)
+        }
+        if strings.Contains(string(bytes), text) {
+            return
+        }
+    }
+}
+
+func TestSocketHandler_leak_01(t *testing.T) {
+    // the browser tab is closed
+    before := runtime.NumGoroutine()
+    server, conn := dialFakeEngine(t)
+    defer server.Close()
+    readSocketUntil(t, conn, "readyok")
+    conn.WriteMessage(websocket.TextMessage, []byte(`{"v":1,"type":"analyze","payload":{"depth":1}}`))
+    readSocketUntil(t, conn, "bestMove")
+
+    conn.Close()
+    server.Close()
+    waitGoroutines(t, before)
+}
+
+func TestSocketHandler_leak_02(t *testing.T) {
+    // the engine dies and is given up
+    policy := DEFAULT_RESTART_POLICY
+    DEFAULT_RESTART_POLICY = RestartPolicy{}
+    defer func() { DEFAULT_RESTART_POLICY = policy }()
+
+    before := runtime.NumGoroutine()
+    server, conn := dialFakeEngine(t)
+    defer server.Close()
+    readSocketUntil(t, conn, "readyok")
+    conn.WriteMessage(websocket.TextMessage, []byte(`{"v":1,"type":"uci","payload":{"line":"crash"}}`))
+    readSocketUntil(t, conn, "giving up")
+
+    // the server closes the socket
+    _, _, err := conn.ReadMessage()
+    assert.NotNil(t, err)
+    conn.Close()
+    server.Close()
+    waitGoroutines(t, before)
+}
+
+func TestSocketHandler_limit_01(t *testing.T) {
+    // a message beyond the limit ends the socket
+    before := runtime.NumGoroutine()
+    server, conn := dialFakeEngine(t)
+    defer server.Close()
+    readSocketUntil(t, conn, "readyok")
+    conn.WriteMessage(websocket.TextMessage, make([]byte, MAX_MESSAGE_SIZE + 1))
+    conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+    for {
+        if _, _, err := conn.ReadMessage(); err != nil {
+            assert.True(t, websocket.IsCloseError(err, websocket.CloseMessageTooBig), err.Error())
+            break
+        }
+    }
+    conn.Close()
+    server.Close()
+    waitGoroutines(t, before)
+}
+
+func TestMultiPlug_leak_01(t *testing.T) {
+    // the session is cancelled while the engine is searching
+    before := runtime.NumGoroutine()
+    ctx, cancel := context.WithCancel(context.Background())
+    w := newFakeWire()
+    done := make(chan bool)
+    go func() {
+        multiPlug(ctx, []*Engine{NewEngine(fakeEngineConfig(t, "fake", "0"))}, w)
+        done <- true
+    }()
+    readUntil(t, w, "readyok")
+    w.input <- `{"v":1,"type":"analyze","payload":{"infinite":true}}`
+    cancel()
+    <-done
+    waitGoroutines(t, before)
+}
+
+func TestMultiPlug_leak_02(t *testing.T) {
+    // the wire is closed while commands and engine output are still on their way
+    before := runtime.NumGoroutine()
+    done := make(chan bool)
+    for i := 0; i < 20; i++ {
+        go func() {
+            w := newFakeWire()
+            ended := make(chan bool)
+            go func() {
+                multiPlug(context.Background(), []*Engine{NewEngine(fakeEngineConfig(t, "fake", "0"))}, w)
+                ended <- true
+            }()
+            readUntil(t, w, "readyok")
+            go func() {
+                for {
+                    select {
+                    case w.input <- `{"v":1,"type":"uci","payload":{"line":"isready"}}`:
+                    case <-ended:
+                        done <- true
+                        return
+                    }
+                }
+            }()
+            time.Sleep(20 * time.Millisecond)
+            close(w.done)
+        }()
+    }
+    for i := 0; i < 20; i++ {
+        select {
+        case <-done:
+        case <-time.After(10 * time.Second):
+            t.Fatal("a session did not end")
+        }
+    }
+    waitGoroutines(t, before)
+}
@@ -0,0 +1,83 @@
+package main
+
+
+import (
+    "fmt"
+    "sort"
+    "strings"
+)
+
+// RankedLines keeps the newest line of every multipv slot during a search,
+// so that the candidate moves can be shown together ordered by rank
+type RankedLines struct {
+    MaxLines int // the value of the MultiPV option, 0 if it was never set
+    lines map[int]*EngineOutput
+}
+
+func NewRankedLines() *RankedLines {
+    return &RankedLines{lines: make(map[int]*EngineOutput)}
+}
+
+// Reset forgets the lines of the last search
+func (r *RankedLines) Reset() {
+    r.lines = make(map[int]*EngineOutput)
+}
+
+// SetMaxLines changes the number of lines, lines of higher rank are dropped
+func (r *RankedLines) SetMaxLines(n int) {
+    r.MaxLines = n
+    for rank := range r.lines {
+        if n > 0 && rank > n {
+            delete(r.lines, rank)
+        }
+    }
+}
+
+// Update stores an info line with a pv in its slot. Lines from a lower depth than the
+// stored one are ignored. The result tells whether the set of lines has changed.
+func (r *RankedLines) Update(output *EngineOutput) bool {
+    if output.Info == nil || output.PrettyLine == "" {
+        return false
+    }
+    rank := output.Info.Rank()
+    if r.MaxLines > 0 && rank > r.MaxLines {
+        return false
+    }
+    if old, ok := r.lines[rank]; ok && old.Info.Depth > output.Info.Depth {
+        return false
+    }
+    r.lines[rank] = output
+    return true
+}
+
+// Lines returns the stored lines ordered by rank, the best line first
+func (r *RankedLines) Lines() []*EngineOutput {
+    ranks := []int{}
+    for rank := range r.lines {
+        ranks = append(ranks, rank)
+    }
+    sort.Ints(ranks)
+
+    lines := []*EngineOutput{}
+    for _, rank := range ranks {
+        lines = append(lines, r.lines[rank])
+    }
+    return lines
+}
+
+// Depth is the depth of the best line, 0 before the first line
+func (r *RankedLines) Depth() int {
+    if best, ok := r.lines[1]; ok {
+        return best.Info.Depth
+    }
+    return 0
+}
+
+// formatRankedLines prints one line per candidate move, e.g. "1) 0.35 - 1.e4 e5 (depth 20)"
+func formatRankedLines(lines []*EngineOutput) string {
+    result := []string{}
+    for _, line := range lines {
+        result = append(result, fmt.Sprintf("%d) %s (depth %d)", line.Info.Rank(), line.String(), line.Info.Depth))
+    }
+    return strings.Join(result, "\n")
+}
@@ -0,0 +1,59 @@
+package main
+
+
+import (
+    "testing"
+    "github.com/stretchr/testify/assert"
+)
+
+func TestRankedLines_01(t *testing.T) {
+    as := NewAnalysisState(STARTPOSITION)
+    as.CmdUpdate("setoption name MultiPV value 2")
+    lines := as.lines
+
+    assert.True(t, lines.Update(NewEngineOutput("info depth 10 multipv 2 score cp 20 pv d2d4 d7d5", as)))
+    assert.True(t, lines.Update(NewEngineOutput("info depth 10 multipv 1 score cp 30 pv e2e4 e7e5", as)))
+    assert.False(t, lines.Update(NewEngineOutput("info depth 10 multipv 3 score cp 10 pv c2c4", as)))
+    assert.False(t, lines.Update(NewEngineOutput("info depth 10 currmove e2e4 currmovenumber 1", as)))
+    assert.Equal(t, 10, lines.Depth())
+    assert.Equal(t, "1) 0.30 - 1.e4 e5 (depth 10)\n2) 0.20 - 1.d4 d5 (depth 10)", formatRankedLines(lines.Lines()))
+
+    // a deeper search replaces the best line, the second line stays until it is updated
+    assert.True(t, lines.Update(NewEngineOutput("info depth 11 multipv 1 score cp 25 pv g1f3", as)))
+    assert.False(t, lines.Update(NewEngineOutput("info depth 9 multipv 2 score cp 99 pv a2a3", as)))
+    assert.Equal(t, "1) 0.25 - 1.Nf3 (depth 11)\n2) 0.20 - 1.d4 d5 (depth 10)", formatRankedLines(lines.Lines()))
+
+    as.CmdUpdate("go infinite")
+    assert.Equal(t, 0, len(lines.Lines()))
+}
+
+func TestRankedLines_02(t *testing.T) {
+    lines := NewRankedLines()
+    as := NewAnalysisState(STARTPOSITION)
+    for _, msg := range []string{
+        "info depth 5 multipv 1 score cp 30 pv e2e4",
+        "info depth 5 multipv 2 score cp 20 pv d2d4",
+        "info depth 5 multipv 3 score cp 10 pv c2c4",
+    } {
+        lines.Update(NewEngineOutput(msg, as))
+    }
+    assert.Equal(t, 3, len(lines.Lines()))
+    lines.SetMaxLines(1)
+    assert.Equal(t, "e2e4", lines.Lines()[0].Info.PV[0])
+    assert.Equal(t, 1, len(lines.Lines()))
+}
+
+func TestAnalysisState_rankedUpdate_01(t *testing.T) {
+    as := NewAnalysisState(STARTPOSITION)
+    as.CmdUpdate("setoption name MultiPV value 2")
+    as.CmdUpdate("go infinite")
+    first := as.rankedUpdate(NewEngineOutput("info depth 10 multipv 1 score cp 30 pv e2e4 e7e5", as))
+    second := as.rankedUpdate(NewEngineOutput("info depth 10 multipv 2 score cp 20 pv d2d4 d7d5", as))
+    assert.Nil(t, as.rankedUpdate(NewEngineOutput("info depth 10 currmove e2e4 currmovenumber 1", as)))
+
+    assert.Equal(t, "1) 0.30 - 1.e4 e5 (depth 10)\n2) 0.20 - 1.d4 d5 (depth 10)", second.String())
+    assert.Equal(t, 1, len(first.Lines))
+    for _, line := range second.Lines {
+        assert.Nil(t, line.Lines)
+    }
+}
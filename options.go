@@ -0,0 +1,223 @@
+package main
+
+
+import (
+    "encoding/json"
+    "fmt"
+    "io/ioutil"
+    "log"
+    "os"
+    "os/exec"
+    "path/filepath"
+    "regexp"
+    "strconv"
+    "strings"
+    "sync"
+)
+
+const (
+    OPTION_CHECK = "check"
+    OPTION_SPIN = "spin"
+    OPTION_COMBO = "combo"
+    OPTION_BUTTON = "button"
+    OPTION_STRING = "string"
+)
+
+// UciOption describes an option the engine announced with "option name ... type ..."
+type UciOption struct {
+    Name string      `json:"name"`
+    Type string      `json:"type"`
+    Default string   `json:"default"`
+    Min int          `json:"min"`
+    Max int          `json:"max"`
+    Vars []string    `json:"vars,omitempty"` // the choices of a combo
+}
+
+// OptionError reports an option value that the engine would not accept
+type OptionError struct {
+    Name string
+    Value string
+    Reason string
+}
+
+func (e *OptionError) Error() string {
+    return fmt.Sprintf("option %s: value '%s' %s", e.Name, e.Value, e.Reason)
+}
+
+var OPTION_KEYWORDS = map[string]bool{"name": true, "type": true, "default": true, "min": true, "max": true, "var": true}
+
+// ParseUciOption reads an option line, e.g. "option name Hash type spin default 16 min 1 max 33554432"
+func ParseUciOption(line string) (*UciOption, error) {
+    fields := strings.Fields(line)
+    if len(fields) == 0 || fields[0] != "option" {
+        return nil, fmt.Errorf("option: not an option line '%s'", line)
+    }
+
+    // values can contain spaces, e.g. "Skill Level", they run until the next keyword
+    values := map[string]string{}
+    option := &UciOption{}
+    for i := 1; i < len(fields); {
+        keyword := fields[i]
+        if !OPTION_KEYWORDS[keyword] {
+            return nil, fmt.Errorf("option: unexpected '%s' in '%s'", keyword, line)
+        }
+        j := i + 1
+        for j < len(fields) && !OPTION_KEYWORDS[fields[j]] { j++ }
+        value := strings.Join(fields[i + 1:j], " ")
+        if keyword == "var" {
+            option.Vars = append(option.Vars, value)
+        } else {
+            values[keyword] = value
+        }
+        i = j
+    }
+
+    option.Name, option.Type, option.Default = values["name"], values["type"], values["default"]
+    if option.Default == "<empty>" {
+        option.Default = ""
+    }
+    if option.Name == "" {
+        return nil, fmt.Errorf("option: missing name in '%s'", line)
+    }
+    switch option.Type {
+    case OPTION_SPIN:
+        var errMin, errMax error
+        option.Min, errMin = strconv.Atoi(values["min"])
+        option.Max, errMax = strconv.Atoi(values["max"])
+        if errMin != nil || errMax != nil {
+            return nil, fmt.Errorf("option: spin without min and max in '%s'", line)
+        }
+    case OPTION_CHECK, OPTION_COMBO, OPTION_BUTTON, OPTION_STRING:
+    default:
+        return nil, fmt.Errorf("option: unknown type '%s' in '%s'", option.Type, line)
+    }
+    return option, nil
+}
+
+// Validate checks a value against the type, the range of a spin and the choices of a combo
+func (o *UciOption) Validate(value string) error {
+    switch o.Type {
+    case OPTION_SPIN:
+        n, err := strconv.Atoi(value)
+        if err != nil {
+            return &OptionError{o.Name, value, "is not a number"}
+        }
+        if n < o.Min || n > o.Max {
+            return &OptionError{o.Name, value, fmt.Sprintf("is not between %d and %d", o.Min, o.Max)}
+        }
+    case OPTION_CHECK:
+        if value != "true" && value != "false" {
+            return &OptionError{o.Name, value, "must be true or false"}
+        }
+    case OPTION_COMBO:
+        for _, v := range o.Vars {
+            if strings.EqualFold(v, value) {
+                return nil
+            }
+        }
+        return &OptionError{o.Name, value, "must be one of " + strings.Join(o.Vars, ", ")}
+    case OPTION_BUTTON:
+        if value != "" {
+            return &OptionError{o.Name, value, "is given for a button"}
+        }
+    }
+    return nil
+}
+
+var REGEX_SETOPTION = regexp.MustCompile(`^setoption\s+name\s+(.+?)(?:\s+value(?:\s+(.*))?)?$`)
+
+// parseSetOption splits a "setoption" command into name and value
+func parseSetOption(cmd string) (name, value string, ok bool) {
+    match := REGEX_SETOPTION.FindStringSubmatch(strings.TrimSpace(cmd))
+    if match == nil {
+        return "", "", false
+    }
+    return match[1], match[2], true
+}
+
+// OptionStore remembers the option values chosen for each engine binary in a json file
+type OptionStore struct {
+    path string
+    mu sync.Mutex
+    values map[string]map[string]string // engine binary -> option name -> value
+}
+
+// LoadOptionStore reads the stored values, a missing file gives an empty store
+func LoadOptionStore(path string) (*OptionStore, error) {
+    store := &OptionStore{path: path, values: make(map[string]map[string]string)}
+    bytes, err := ioutil.ReadFile(path)
+    if os.IsNotExist(err) {
+        return store, nil
+    }
+    if err != nil {
+        return store, err
+    }
+    if err := json.Unmarshal(bytes, &store.values); err != nil {
+        return store, fmt.Errorf("option store %s: %s", path, err)
+    }
+    return store, nil
+}
+
+var defaultOptionStore *OptionStore
+var defaultOptionStoreOnce sync.Once
+
+// DefaultOptionStore is the store in the user's config directory shared by all engines
+func DefaultOptionStore() *OptionStore {
+    defaultOptionStoreOnce.Do(func() {
+        dir, err := os.UserConfigDir()
+        if err != nil {
+            dir = "."
+        }
+        store, err := LoadOptionStore(filepath.Join(dir, "harpa", "engine-options.json"))
+        if err != nil {
+            log.Println(err)
+        }
+        defaultOptionStore = store
+    })
+    return defaultOptionStore
+}
+
+// Values returns a copy of the values stored for an engine
+func (s *OptionStore) Values(engine string) map[string]string {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    values := map[string]string{}
+    for name, value := range s.values[engine] {
+        values[name] = value
+    }
+    return values
+}
+
+// Set stores the value of an option for an engine and writes the file
+func (s *OptionStore) Set(engine, name, value string) error {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    if old, ok := s.values[engine][name]; ok && old == value {
+        return nil
+    }
+    if s.values[engine] == nil {
+        s.values[engine] = map[string]string{}
+    }
+    s.values[engine][name] = value
+
+    bytes, err := json.MarshalIndent(s.values, "", "  ")
+    if err != nil {
+        return err
+    }
+    if err := os.MkdirAll(filepath.Dir(s.path), 0755); err != nil {
+        return err
+    }
+    return ioutil.WriteFile(s.path, bytes, 0644)
+}
+
+// engineKey identifies an engine binary in the option store by its absolute path
+func engineKey(command string) string {
+    path, err := exec.LookPath(command)
+    if err != nil {
+        return command
+    }
+    if abs, err := filepath.Abs(path); err == nil {
+        return abs
+    }
+    return path
+}
@@ -0,0 +1,77 @@
+package main
+
+
+import (
+    "context"
+    "path/filepath"
+    "testing"
+    "github.com/stretchr/testify/assert"
+)
+
+func TestParseUciOption_01(t *testing.T) {
+    option, err := ParseUciOption("option name Skill Level type spin default 20 min 0 max 20")
+    assert.Nil(t, err)
+    assert.Equal(t, &UciOption{Name: "Skill Level", Type: OPTION_SPIN, Default: "20", Min: 0, Max: 20}, option)
+
+    option, _ = ParseUciOption("option name Analysis Contempt type combo default Both var Off var White var Black var Both")
+    assert.Equal(t, []string{"Off", "White", "Black", "Both"}, option.Vars)
+    assert.Equal(t, "Both", option.Default)
+
+    option, _ = ParseUciOption("option name SyzygyPath type string default <empty>")
+    assert.Equal(t, &UciOption{Name: "SyzygyPath", Type: OPTION_STRING}, option)
+
+    option, _ = ParseUciOption("option name Clear Hash type button")
+    assert.Equal(t, &UciOption{Name: "Clear Hash", Type: OPTION_BUTTON}, option)
+
+    _, err = ParseUciOption("option name Hash type spin default 16")
+    assert.NotNil(t, err)
+    _, err = ParseUciOption("option name Hash type slider")
+    assert.NotNil(t, err)
+}
+
+func TestUciOption_Validate_01(t *testing.T) {
+    hash := &UciOption{Name: "Hash", Type: OPTION_SPIN, Min: 1, Max: 1024}
+    assert.Nil(t, hash.Validate("256"))
+    assert.Equal(t, &OptionError{"Hash", "2048", "is not between 1 and 1024"}, hash.Validate("2048"))
+    assert.NotNil(t, hash.Validate("lots"))
+
+    ponder := &UciOption{Name: "Ponder", Type: OPTION_CHECK}
+    assert.Nil(t, ponder.Validate("true"))
+    assert.NotNil(t, ponder.Validate("yes"))
+
+    contempt := &UciOption{Name: "Analysis Contempt", Type: OPTION_COMBO, Vars: []string{"Off", "White"}}
+    assert.Nil(t, contempt.Validate("white"))
+    assert.NotNil(t, contempt.Validate("Black"))
+}
+
+func TestParseSetOption_01(t *testing.T) {
+    name, value, ok := parseSetOption("setoption name Skill Level value 10")
+    assert.Equal(t, []interface{}{"Skill Level", "10", true}, []interface{}{name, value, ok})
+    name, value, ok = parseSetOption("setoption name Clear Hash")
+    assert.Equal(t, []interface{}{"Clear Hash", "", true}, []interface{}{name, value, ok})
+    _, _, ok = parseSetOption("go infinite")
+    assert.False(t, ok)
+}
+
+func TestUciClient_SetOption_01(t *testing.T) {
+    client, _ := newFakeClient(t)
+    ctx := context.Background()
+    assert.Nil(t, client.SetOption(ctx, "hash", "64"))
+    assert.NotNil(t, client.SetOption(ctx, "Hash", "4096"))
+    assert.NotNil(t, client.SetOption(ctx, "Threads", "4"))
+}
+
+func TestOptionStore_01(t *testing.T) {
+    dir := t.TempDir()
+    path := filepath.Join(dir, "harpa", "engine-options.json")
+
+    store, err := LoadOptionStore(path)
+    assert.Nil(t, err)
+    assert.Nil(t, store.Set("/usr/bin/stockfish", "Hash", "256"))
+    assert.Nil(t, store.Set("/usr/bin/stockfish", "MultiPV", "3"))
+
+    again, err := LoadOptionStore(path)
+    assert.Nil(t, err)
+    assert.Equal(t, map[string]string{"Hash": "256", "MultiPV": "3"}, again.Values("/usr/bin/stockfish"))
+    assert.Equal(t, map[string]string{}, again.Values("lc0"))
+}
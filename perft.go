@@ -0,0 +1,89 @@
+package main
+
+
+import (
+    "fmt"
+    "log"
+    "sort"
+    "strconv"
+    "strings"
+)
+
+// PerftMain counts the leaf nodes of the move tree
+// usage: perft [divide] <depth> [fen]
+func PerftMain(args []string) {
+    divide := false
+    if len(args) > 0 && args[0] == "divide" {
+        divide = true
+        args = args[1:]
+    }
+    if len(args) == 0 {
+        fmt.Println("usage: perft [divide] <depth> [fen]")
+        return
+    }
+    depth, err := strconv.Atoi(args[0])
+    if err != nil || depth < 0 {
+        fmt.Printf("invalid depth '%s'\n", args[0])
+        return
+    }
+    fenString := STARTPOSITION
+    if len(args) > 1 {
+        fenString = strings.Join(args[1:], " ")
+    }
+
+    fen, err := ParseFen(fenString)
+    if err != nil {
+        log.Fatal(err)
+    }
+    board := NewBitBoard(fen)
+    if !divide {
+        fmt.Println(Perft(board, depth))
+        return
+    }
+
+    counts := Divide(board, depth)
+    uciMoves := []string{}
+    total := 0
+    for uciMove, count := range counts {
+        uciMoves = append(uciMoves, uciMove)
+        total += count
+    }
+    sort.Strings(uciMoves)
+    for _, uciMove := range uciMoves {
+        fmt.Printf("%s: %d\n", uciMove, counts[uciMove])
+    }
+    fmt.Printf("\nmoves: %d\nnodes: %d\n", len(uciMoves), total)
+}
+
+// Perft returns the number of positions that are reached after depth plies
+func Perft(board *BitBoard, depth int) int {
+    if depth == 0 {
+        return 1
+    }
+    moves := board.LegalMoves()
+    if depth == 1 {
+        return len(moves)
+    }
+
+    nodes := 0
+    for _, move := range moves {
+        board.Make(move)
+        nodes += Perft(board, depth - 1)
+        board.Unmake()
+    }
+    return nodes
+}
+
+// Divide returns the perft count for every legal move in the position
+func Divide(board *BitBoard, depth int) map[string]int {
+    result := make(map[string]int)
+    if depth == 0 {
+        return result
+    }
+    for _, move := range board.LegalMoves() {
+        board.Make(move)
+        result[move.uciMove] = Perft(board, depth - 1)
+        board.Unmake()
+    }
+    return result
+}
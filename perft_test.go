@@ -0,0 +1,69 @@
+package main
+
+
+import (
+    "testing"
+    "github.com/stretchr/testify/assert"
+)
+
+// reference values from https://www.chessprogramming.org/Perft_Results
+var perftPositions = []struct {
+    name string
+    fen string
+    depth int
+    nodes int
+}{
+    {"start position", STARTPOSITION, 3, 8902},
+    {"kiwipete", "r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R w KQkq - 0 1", 2, 2039},
+    {"en passant", "8/2p5/3p4/KP5r/1R3p1k/8/4P1P1/8 w - - 0 1", 4, 43238},
+    {"promotion", "r3k2r/Pppp1ppp/1b3nbN/nP6/BBP1P3/q4N2/Pp1P2PP/R2Q1RK1 w kq - 0 1", 3, 9467},
+    {"promotion mirrored", "r2q1rk1/pP1p2pp/Q4n2/bbp1p3/Np6/1B3NBn/pPPP1PPP/R3K2R b KQ - 0 1", 3, 9467},
+    {"check evasion", "rnbq1k1r/pp1Pbppp/2p5/8/2B5/8/PPP1NnPP/RNBQK2R w KQ - 1 8", 3, 62379},
+    {"middle game", "r4rk1/1pp1qppp/p1np1n2/2b1p1B1/2B1P1b1/P1NP1N2/1PP1QPPP/R4RK1 w - - 0 10", 2, 2079},
+}
+
+// deeper searches that take a few seconds
+var perftPositionsLong = []struct {
+    name string
+    fen string
+    depth int
+    nodes int
+}{
+    {"start position", STARTPOSITION, 4, 197281},
+    {"kiwipete", "r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R w KQkq - 0 1", 3, 97862},
+}
+
+func TestPerft(t *testing.T) {
+    for _, pos := range perftPositions {
+        board := NewBitBoard(NewFen(pos.fen))
+        assert.Equal(t, pos.nodes, Perft(board, pos.depth), pos.name)
+    }
+}
+
+func TestPerft_long(t *testing.T) {
+    if testing.Short() {
+        t.Skip("skipping deep perft in short mode")
+    }
+    for _, pos := range perftPositionsLong {
+        board := NewBitBoard(NewFen(pos.fen))
+        assert.Equal(t, pos.nodes, Perft(board, pos.depth), pos.name)
+    }
+}
+
+func TestPerft_board_unchanged(t *testing.T) {
+    board := NewBitBoardStart()
+    Perft(board, 2)
+    assert.Equal(t, 20, len(board.LegalMoves()))
+}
+
+func TestDivide_01(t *testing.T) {
+    board := NewBitBoard(NewFen("r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R w KQkq - 0 1"))
+    counts := Divide(board, 2)
+    assert.Equal(t, 48, len(counts))
+
+    total := 0
+    for _, count := range counts {
+        total += count
+    }
+    assert.Equal(t, 2039, total)
+}
@@ -0,0 +1,383 @@
+package main
+
+
+import (
+    "fmt"
+    "io"
+    "io/ioutil"
+    "os"
+    "regexp"
+    "strconv"
+    "strings"
+)
+
+// Game is a game of chess read from PGN
+type Game struct {
+    Tags []Tag // in the order they appear
+    Root *Node // the starting position, it has no move
+    Result string
+}
+
+type Tag struct {
+    Name string
+    Value string
+}
+
+// Node is a position in the game tree together with the move that leads to it
+type Node struct {
+    Board *BitBoard // position after the move
+    Move *Move      // nil for the root
+    Parent *Node
+    Children []*Node // the first child continues the main line, the others are variations
+
+    StartComment string // comment before the move, only at the start of a variation
+    Comment string      // comment after the move
+    NAGs []int          // numeric annotation glyphs, $1 = !, $2 = ?, ...
+    Eval *Score         // engine evaluation of the position, stored as %eval in the comment
+}
+
+// PgnError reports where a PGN file could not be read
+type PgnError struct {
+    Game int // number of the game, starting with 1
+    Line int
+    Reason string
+}
+
+func (e *PgnError) Error() string {
+    return fmt.Sprintf("pgn: game %d, line %d: %s", e.Game, e.Line, e.Reason)
+}
+
+var SAN_ANNOTATION_TO_NAG = map[string]int{
+    "!": 1, "?": 2, "!!": 3, "??": 4, "!?": 5, "?!": 6,
+}
+
+var PGN_RESULTS = map[string]bool{
+    RESULT_WHITE_WINS: true, RESULT_BLACK_WINS: true, RESULT_DRAW: true, RESULT_UNKNOWN: true,
+}
+
+// Tag returns the value of a tag pair, "" if the game has no such tag
+func (g *Game) Tag(name string) string {
+    for _, tag := range g.Tags {
+        if tag.Name == name {
+            return tag.Value
+        }
+    }
+    return ""
+}
+
+// SetTag changes the value of a tag pair or adds a new one
+func (g *Game) SetTag(name, value string) {
+    for i, tag := range g.Tags {
+        if tag.Name == name {
+            g.Tags[i].Value = value
+            return
+        }
+    }
+    g.Tags = append(g.Tags, Tag{name, value})
+}
+
+// MainLine returns the nodes of the main line without the root
+func (g *Game) MainLine() []*Node {
+    nodes := []*Node{}
+    for node := g.Root; len(node.Children) > 0; node = node.Children[0] {
+        nodes = append(nodes, node.Children[0])
+    }
+    return nodes
+}
+
+// AddChild plays a move from this node. An existing child with the same move is reused.
+// The board of the child only remembers the positions the repetition rules need.
+func (node *Node) AddChild(move *Move) *Node {
+    for _, child := range node.Children {
+        if child.Move.uciMove == move.uciMove {
+            return child
+        }
+    }
+    board := node.Board.CloneRecent()
+    board.Make(move)
+    move.isCheck = board.isCheck(!board.toMove)
+    move.isCheckmate = move.isCheck && board.Status() == CHECKMATE
+    child := &Node{Board: board, Move: move, Parent: node}
+    node.Children = append(node.Children, child)
+    return child
+}
+
+// ReadPGNFile reads all games from a PGN file
+func ReadPGNFile(path string) ([]*Game, error) {
+    file, err := os.Open(path)
+    if err != nil {
+        return nil, err
+    }
+    defer file.Close()
+    return ParsePGN(file)
+}
+
+// ParsePGN reads all games from PGN text. The games that were read before an error are returned with the error.
+func ParsePGN(r io.Reader) ([]*Game, error) {
+    bytes, err := ioutil.ReadAll(r)
+    if err != nil {
+        return nil, err
+    }
+    parser := &pgnParser{tokens: tokenizePGN(string(bytes))}
+
+    games := []*Game{}
+    for !parser.done() {
+        game, err := parser.game(len(games) + 1)
+        if err != nil {
+            return games, err
+        }
+        games = append(games, game)
+    }
+    return games, nil
+}
+
+const (
+    PGN_SYMBOL = iota
+    PGN_STRING
+    PGN_COMMENT
+    PGN_NAG
+    PGN_OPEN_TAG
+    PGN_CLOSE_TAG
+    PGN_OPEN_VARIATION
+    PGN_CLOSE_VARIATION
+)
+
+type pgnToken struct {
+    kind int
+    value string
+    line int
+}
+
+// tokenizePGN splits PGN text into tokens, move number indications and escaped lines are dropped
+func tokenizePGN(text string) []pgnToken {
+    tokens := []pgnToken{}
+    runes := []rune(text)
+    line := 1
+    lineStart := true
+
+    for i := 0; i < len(runes); i++ {
+        r := runes[i]
+        if r == '\n' {
+            line++
+            lineStart = true
+            continue
+        }
+        if r == '%' && lineStart {
+            // escape mechanism, skip the whole line
+            for i + 1 < len(runes) && runes[i + 1] != '\n' { i++ }
+            continue
+        }
+        lineStart = false
+
+        switch {
+        case r == ' ' || r == '\t' || r == '\r' || r == '.':
+            continue
+        case r == '[':
+            tokens = append(tokens, pgnToken{PGN_OPEN_TAG, "[", line})
+        case r == ']':
+            tokens = append(tokens, pgnToken{PGN_CLOSE_TAG, "]", line})
+        case r == '(':
+            tokens = append(tokens, pgnToken{PGN_OPEN_VARIATION, "(", line})
+        case r == ')':
+            tokens = append(tokens, pgnToken{PGN_CLOSE_VARIATION, ")", line})
+        case r == ';':
+            start := i + 1
+            for i + 1 < len(runes) && runes[i + 1] != '\n' { i++ }
+            tokens = append(tokens, pgnToken{PGN_COMMENT, strings.TrimSpace(string(runes[start:i + 1])), line})
+        case r == '{':
+            start, startLine := i + 1, line
+            for i + 1 < len(runes) && runes[i + 1] != '}' {
+                i++
+                if runes[i] == '\n' { line++ }
+            }
+            tokens = append(tokens, pgnToken{PGN_COMMENT, strings.TrimSpace(string(runes[start:i + 1])), startLine})
+            i++ // closing brace
+        case r == '"':
+            value := []rune{}
+            for i + 1 < len(runes) && runes[i + 1] != '"' && runes[i + 1] != '\n' {
+                i++
+                if runes[i] == '\\' && i + 1 < len(runes) {
+                    i++
+                }
+                value = append(value, runes[i])
+            }
+            tokens = append(tokens, pgnToken{PGN_STRING, string(value), line})
+            i++ // closing quote
+        case r == '$':
+            start := i + 1
+            for i + 1 < len(runes) && runes[i + 1] >= '0' && runes[i + 1] <= '9' { i++ }
+            tokens = append(tokens, pgnToken{PGN_NAG, string(runes[start:i + 1]), line})
+        default:
+            start := i
+            for i + 1 < len(runes) && !strings.ContainsRune(" \t\r\n[](){};\"$", runes[i + 1]) &&
+                !(runes[i + 1] == '.' && isMoveNumber(string(runes[start:i + 1]))) {
+                i++
+            }
+            symbol := string(runes[start:i + 1])
+            if !isMoveNumber(symbol) {
+                tokens = append(tokens, pgnToken{PGN_SYMBOL, symbol, line})
+            }
+        }
+    }
+    return tokens
+}
+
+func isMoveNumber(symbol string) bool {
+    _, err := strconv.Atoi(symbol)
+    return err == nil
+}
+
+type pgnParser struct {
+    tokens []pgnToken
+    pos int
+}
+
+func (p *pgnParser) done() bool {
+    return p.pos >= len(p.tokens)
+}
+
+func (p *pgnParser) peek() pgnToken {
+    return p.tokens[p.pos]
+}
+
+func (p *pgnParser) next() pgnToken {
+    token := p.tokens[p.pos]
+    p.pos++
+    return token
+}
+
+var SAN_WITH_ANNOTATION_REGEX = regexp.MustCompile(`^(.*?)([!?]{1,2})$`)
+
+// game reads the tag pairs and the movetext of one game
+func (p *pgnParser) game(number int) (*Game, error) {
+    fail := func(line int, reason string, args ...interface{}) (*Game, error) {
+        return nil, &PgnError{number, line, fmt.Sprintf(reason, args...)}
+    }
+
+    game := &Game{Result: RESULT_UNKNOWN}
+    for !p.done() && p.peek().kind == PGN_OPEN_TAG {
+        open := p.next()
+        if p.pos + 2 > len(p.tokens) || p.tokens[p.pos].kind != PGN_SYMBOL || p.tokens[p.pos + 1].kind != PGN_STRING {
+            return fail(open.line, "malformed tag pair")
+        }
+        name, value := p.next().value, p.next().value
+        if p.done() || p.next().kind != PGN_CLOSE_TAG {
+            return fail(open.line, "tag pair '%s' is not closed", name)
+        }
+        game.Tags = append(game.Tags, Tag{name, value})
+    }
+
+    board := NewBitBoardStart()
+    if fenString := game.Tag("FEN"); fenString != "" {
+        fen, err := ParseFen(fenString)
+        if err != nil {
+            return fail(p.lastLine(), "%s", err)
+        }
+        board = NewBitBoard(fen)
+    }
+    game.Root = &Node{Board: board}
+
+    current := game.Root
+    variations := []*Node{} // the moves that the open variations replace
+    variationStart := false  // no move has been played in the current variation yet
+    startComment := ""
+    for !p.done() {
+        token := p.peek()
+        if token.kind == PGN_OPEN_TAG {
+            break // next game without a result
+        }
+        p.next()
+
+        switch token.kind {
+        case PGN_COMMENT:
+            if variationStart {
+                startComment = joinComments(startComment, token.value)
+                break
+            }
+            comment, eval := extractPgnEval(token.value)
+            current.Comment = joinComments(current.Comment, comment)
+            if eval != nil {
+                current.Eval = eval
+            }
+        case PGN_NAG:
+            nag, err := strconv.Atoi(token.value)
+            if err != nil || current == game.Root {
+                return fail(token.line, "unexpected NAG '$%s'", token.value)
+            }
+            current.NAGs = append(current.NAGs, nag)
+        case PGN_OPEN_VARIATION:
+            if current.Parent == nil {
+                return fail(token.line, "variation without a move")
+            }
+            variations = append(variations, current)
+            current = current.Parent
+            variationStart = true
+        case PGN_CLOSE_VARIATION:
+            if len(variations) == 0 {
+                return fail(token.line, "unexpected ')'")
+            }
+            current = variations[len(variations) - 1]
+            variations = variations[:len(variations) - 1]
+            variationStart = false
+            startComment = ""
+        case PGN_SYMBOL:
+            if PGN_RESULTS[token.value] {
+                if len(variations) > 0 {
+                    return fail(token.line, "result inside a variation")
+                }
+                game.Result = token.value
+                if game.Tag("Result") == "" {
+                    game.SetTag("Result", token.value)
+                }
+                return game, nil
+            }
+            if token.value == "e.p." {
+                continue
+            }
+            if nag, ok := SAN_ANNOTATION_TO_NAG[token.value]; ok {
+                // annotation separated by a space from its move
+                if current == game.Root {
+                    return fail(token.line, "unexpected '%s'", token.value)
+                }
+                current.NAGs = append(current.NAGs, nag)
+                continue
+            }
+
+            san, annotation := token.value, ""
+            if match := SAN_WITH_ANNOTATION_REGEX.FindStringSubmatch(san); match != nil {
+                san, annotation = match[1], match[2]
+            }
+            move, err := current.Board.ParseSAN(san)
+            if err != nil {
+                return fail(token.line, "%s", err)
+            }
+            current = current.AddChild(move)
+            current.StartComment = startComment
+            variationStart = false
+            startComment = ""
+            if nag, ok := SAN_ANNOTATION_TO_NAG[annotation]; ok {
+                current.NAGs = append(current.NAGs, nag)
+            }
+        default:
+            return fail(token.line, "unexpected '%s'", token.value)
+        }
+    }
+    if len(variations) > 0 {
+        return fail(p.lastLine(), "variation is not closed")
+    }
+    return game, nil
+}
+
+func (p *pgnParser) lastLine() int {
+    if p.pos == 0 || len(p.tokens) == 0 {
+        return 1
+    }
+    return p.tokens[p.pos - 1].line
+}
+
+func joinComments(a, b string) string {
+    if a == "" {
+        return b
+    }
+    return a + " " + b
+}
@@ -0,0 +1,113 @@
+package main
+
+
+import (
+    "strings"
+    "testing"
+    "github.com/stretchr/testify/assert"
+)
+
+const PGN_SAMPLE = `[Event "Reykjavik Open"]
+[Site "Reykjavik ISL"]
+[Date "2016.03.13"]
+[Round "9"]
+[White "Player, A."]
+[Black "Player, \"B\"."]
+[Result "1-0"]
+
+{Opening comment} 1. e4 e5 2. Nf3 Nc6 3. Bb5 {The Ruy Lopez.} a6 (3... Nf6 4. O-O
+(4. d3 Bc5) 4... Nxe4 $2 ; the Berlin
+) 4. Ba4 Nf6 5. O-O! Be7 6. Re1 b5 7. Bb3 d6 8. c3 O-O 9. h3 Nb8 10. d4 Nbd7 11. Nbd2 Bb7 12. Bc2 Re8 13. Nf1 Bf8 14. Ng3 g6 15. a4 c5 16. d5 c4 17. Bg5 h6 18. Be3 Nc5 19. Qd2 h5 20. Bg5?! Be7 1-0
+
+[Event "Second"]
+[White "C"]
+[Black "D"]
+[Result "*"]
+[SetUp "1"]
+[FEN "4k3/8/8/8/8/8/4P3/4K3 w - - 0 1"]
+
+1. e4 Kd7 2. e5 ( { a start comment } 2. Kd2 ) *
+`
+
+func TestParsePGN_01(t *testing.T) {
+    games, err := ParsePGN(strings.NewReader(PGN_SAMPLE))
+    assert.Nil(t, err)
+    assert.Equal(t, 2, len(games))
+
+    game := games[0]
+    assert.Equal(t, "Reykjavik Open", game.Tag("Event"))
+    assert.Equal(t, `Player, "B".`, game.Tag("Black"))
+    assert.Equal(t, 7, len(game.Tags))
+    assert.Equal(t, "1-0", game.Result)
+    assert.Equal(t, "Opening comment", game.Root.Comment)
+
+    mainLine := game.MainLine()
+    assert.Equal(t, 40, len(mainLine))
+    assert.Equal(t, "e2e4", mainLine[0].Move.UCI())
+    assert.Equal(t, "The Ruy Lopez.", mainLine[4].Comment)
+    assert.Equal(t, []int{1}, mainLine[8].NAGs)   // 5. O-O!
+    assert.Equal(t, "e1g1", mainLine[8].Move.UCI())
+    assert.Equal(t, []int{6}, mainLine[38].NAGs)  // 20. Bg5?!
+    assert.Equal(t, "r2qrbk1/1b3p2/p2p1np1/1pnPp1Bp/P1p1P3/2P2NNP/1PBQ1PP1/R3R1K1 b - - 1 20", mainLine[38].Board.FEN())
+
+    // 3... Nf6 4. O-O (4. d3 Bc5) 4... Nxe4 $2
+    variation := mainLine[4].Children
+    assert.Equal(t, 2, len(variation))
+    berlin := variation[1]
+    assert.Equal(t, "g8f6", berlin.Move.UCI())
+    assert.Equal(t, 2, len(berlin.Children))
+    assert.Equal(t, "e1g1", berlin.Children[0].Move.UCI())
+    assert.Equal(t, "d2d3", berlin.Children[1].Move.UCI())
+    assert.Equal(t, "f8c5", berlin.Children[1].Children[0].Move.UCI())
+    nxe4 := berlin.Children[0].Children[0]
+    assert.Equal(t, "f6e4", nxe4.Move.UCI())
+    assert.Equal(t, []int{2}, nxe4.NAGs)
+    assert.Equal(t, "the Berlin", nxe4.Comment)
+}
+
+func TestParsePGN_02(t *testing.T) {
+    // game with a start position and a comment at the start of a variation
+    games, _ := ParsePGN(strings.NewReader(PGN_SAMPLE))
+    game := games[1]
+    assert.Equal(t, "*", game.Result)
+    assert.Equal(t, "4k3/8/8/8/8/8/4P3/4K3 w - - 0 1", game.Root.Board.FEN())
+
+    mainLine := game.MainLine()
+    assert.Equal(t, 3, len(mainLine))
+    kd2 := mainLine[1].Children[1]
+    assert.Equal(t, "e1d2", kd2.Move.UCI())
+    assert.Equal(t, "a start comment", kd2.StartComment)
+}
+
+func TestParsePGN_history_01(t *testing.T) {
+    // the boards of the nodes only remember the positions since the last pawn move
+    games, _ := ParsePGN(strings.NewReader("1. Nf3 Nf6 2. Ng1 Ng8 3. Nf3 Nf6 4. Ng1 Ng8 5. e4 Nf6 6. Nf3 *"))
+    mainLine := games[0].MainLine()
+    assert.Equal(t, THREEFOLD_REPETITION, mainLine[7].Board.ClaimableDraw())
+    assert.Equal(t, 8, len(mainLine[7].Board.history))
+    assert.Equal(t, 2, len(mainLine[10].Board.history))
+}
+
+func TestParsePGN_errors_01(t *testing.T) {
+    invalid := []string{
+        "1. e4 e5 2. Ke3 *",
+        "1. e4 (1. d4 *",
+        "1. e4 ) *",
+        "[Event \"x\" 1. e4 *",
+        "[FEN \"8/8/8/8/8/8/8/8 w - - 0 1\"]\n1. e4 *",
+    }
+    for _, text := range invalid {
+        _, err := ParsePGN(strings.NewReader(text))
+        assert.IsType(t, &PgnError{}, err, text)
+    }
+}
+
+func TestParsePGN_errors_02(t *testing.T) {
+    // the games before the broken one are returned
+    games, err := ParsePGN(strings.NewReader("1. e4 e5 1-0\n\n1. e4 e4 0-1\n"))
+    assert.Equal(t, 1, len(games))
+    if assert.IsType(t, &PgnError{}, err) {
+        assert.Equal(t, 2, err.(*PgnError).Game)
+        assert.Equal(t, 3, err.(*PgnError).Line)
+    }
+}
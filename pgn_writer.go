@@ -0,0 +1,200 @@
+package main
+
+
+import (
+    "bytes"
+    "io"
+    "strconv"
+    "strings"
+)
+
+const PGN_LINE_WIDTH = 80
+
+// SEVEN_TAG_ROSTER are the tags every exported game starts with, together with their defaults
+var SEVEN_TAG_ROSTER = []Tag{
+    Tag{"Event", "?"},
+    Tag{"Site", "?"},
+    Tag{"Date", "????.??.??"},
+    Tag{"Round", "?"},
+    Tag{"White", "?"},
+    Tag{"Black", "?"},
+    Tag{"Result", RESULT_UNKNOWN},
+}
+
+// PGN returns the game in the PGN export format
+func (g *Game) PGN() string {
+    var buffer bytes.Buffer
+    g.WritePGN(&buffer)
+    return buffer.String()
+}
+
+// WritePGNGames writes several games separated by an empty line
+func WritePGNGames(w io.Writer, games []*Game) error {
+    for i, game := range games {
+        if i > 0 {
+            if _, err := io.WriteString(w, "\n"); err != nil {
+                return err
+            }
+        }
+        if err := game.WritePGN(w); err != nil {
+            return err
+        }
+    }
+    return nil
+}
+
+// WritePGN writes the tag pairs and the movetext with variations, comments, NAGs
+// and evaluations as %eval comments. Lines are wrapped at 80 columns.
+func (g *Game) WritePGN(w io.Writer) error {
+    result := g.Result
+    if result == "" {
+        result = RESULT_UNKNOWN
+    }
+
+    tags := []Tag{}
+    for _, tag := range SEVEN_TAG_ROSTER {
+        value := g.Tag(tag.Name)
+        if tag.Name == "Result" {
+            value = result
+        } else if value == "" {
+            value = tag.Value
+        }
+        tags = append(tags, Tag{tag.Name, value})
+    }
+    if fenString := g.Root.Board.FEN(); fenString != STARTPOSITION && g.Tag("FEN") == "" {
+        tags = append(tags, Tag{"SetUp", "1"}, Tag{"FEN", fenString})
+    }
+    for _, tag := range g.Tags {
+        if !isSevenTagRoster(tag.Name) {
+            tags = append(tags, tag)
+        }
+    }
+
+    text := ""
+    for _, tag := range tags {
+        value := strings.Replace(strings.Replace(tag.Value, `\`, `\\`, -1), `"`, `\"`, -1)
+        text += "[" + tag.Name + " \"" + value + "\"]\n"
+    }
+    text += "\n"
+
+    writer := &pgnLineWriter{}
+    if g.Root.Comment != "" || g.Root.Eval != nil {
+        writer.comment(g.Root.Eval, g.Root.Comment)
+    }
+    writer.line(g.Root, true)
+    writer.word(result)
+    text += writer.String() + "\n"
+
+    _, err := io.WriteString(w, text)
+    return err
+}
+
+func isSevenTagRoster(name string) bool {
+    for _, tag := range SEVEN_TAG_ROSTER {
+        if tag.Name == name {
+            return true
+        }
+    }
+    return false
+}
+
+// pgnLineWriter collects the movetext and wraps the lines
+type pgnLineWriter struct {
+    lines []string
+    current string
+    prefix string // written directly before the next word
+}
+
+func (pw *pgnLineWriter) word(word string) {
+    word = pw.prefix + word
+    pw.prefix = ""
+    if pw.current == "" {
+        pw.current = word
+    } else if len(pw.current) + 1 + len(word) > PGN_LINE_WIDTH {
+        pw.lines = append(pw.lines, pw.current)
+        pw.current = word
+    } else {
+        pw.current += " " + word
+    }
+}
+
+// suffix appends text to the last word, the word moves on to the next line if the line gets too long
+func (pw *pgnLineWriter) suffix(text string) {
+    last := strings.LastIndex(pw.current, " ")
+    if len(pw.current) + len(text) <= PGN_LINE_WIDTH || last < 0 {
+        pw.current += text
+        return
+    }
+    pw.lines = append(pw.lines, pw.current[:last])
+    pw.current = pw.current[last + 1:] + text
+}
+
+func (pw *pgnLineWriter) String() string {
+    return strings.Join(append(pw.lines, pw.current), "\n")
+}
+
+func (pw *pgnLineWriter) comment(eval *Score, comment string) {
+    text := comment
+    if eval != nil {
+        text = strings.TrimSpace(eval.PgnEval() + " " + comment)
+    }
+    words := strings.Fields(strings.Replace(text, "}", "", -1))
+    if len(words) == 0 {
+        return
+    }
+    words[0] = "{" + words[0]
+    words[len(words) - 1] += "}"
+    for _, word := range words {
+        pw.word(word)
+    }
+}
+
+// move writes a move with its annotations. Black moves get a number only when asked for.
+func (pw *pgnLineWriter) move(node *Node, withNumber bool) {
+    if node.StartComment != "" {
+        pw.comment(nil, node.StartComment)
+    }
+    board := node.Parent.Board
+    if board.WhiteToMove() || withNumber {
+        pw.word(styleLineWith(pgnMove, []*Move{node.Move}, board.MoveNumber(), board.WhiteToMove(), ""))
+    } else {
+        pw.word(pgnMove(node.Move))
+    }
+    for _, nag := range node.NAGs {
+        pw.word("$" + strconv.Itoa(nag))
+    }
+    if node.Comment != "" || node.Eval != nil {
+        pw.comment(node.Eval, node.Comment)
+    }
+}
+
+// line writes the main line from a node on, variations are written in parentheses after the main move
+func (pw *pgnLineWriter) line(node *Node, withNumber bool) {
+    for len(node.Children) > 0 {
+        main := node.Children[0]
+        pw.move(main, withNumber)
+        withNumber = main.Comment != "" || main.Eval != nil
+
+        for _, variation := range node.Children[1:] {
+            pw.prefix = "("
+            pw.move(variation, true)
+            pw.line(variation, variation.Comment != "" || variation.Eval != nil)
+            pw.suffix(")")
+            withNumber = true
+        }
+        node = main
+    }
+}
+
+// pgnMove styles a move like styleMove, but with the letter O for castling
+// and a "=" before the promotion piece as the PGN export format demands
+func pgnMove(move *Move) string {
+    if move.isCastling {
+        return strings.Replace(move.castlingType.String(), "0", "O", -1) + getCheckString(move)
+    }
+    if move.isPromotion {
+        return getCaptureString(move) + move.targetSquare.name + "=" +
+            PIECE_TO_ALGEBRAIC[move.promotionPiece] + getCheckString(move)
+    }
+    return styleMove(move)
+}
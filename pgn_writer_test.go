@@ -0,0 +1,98 @@
+package main
+
+
+import (
+    "strings"
+    "testing"
+    "github.com/stretchr/testify/assert"
+)
+
+func TestWritePGN_01(t *testing.T) {
+    games, _ := ParsePGN(strings.NewReader(PGN_SAMPLE))
+    game := games[0]
+    game.MainLine()[2].Eval = &Score{Value: 35}
+    game.MainLine()[3].Eval = &Score{Mate: true, Value: -3}
+
+    expected := `[Event "Reykjavik Open"]
+[Site "Reykjavik ISL"]
+[Date "2016.03.13"]
+[Round "9"]
+[White "Player, A."]
+[Black "Player, \"B\"."]
+[Result "1-0"]
+
+{Opening comment} 1.e4 e5 2.Nf3 {[%eval 0.35]} 2...Nc6 {[%eval #-3]} 3.Bb5 {The
+Ruy Lopez.} 3...a6 (3...Nf6 4.O-O (4.d3 Bc5) 4...Nxe4 $2 {the Berlin}) 4.Ba4 Nf6
+5.O-O $1 Be7 6.Re1 b5 7.Bb3 d6 8.c3 O-O 9.h3 Nb8 10.d4 Nbd7 11.Nbd2 Bb7 12.Bc2
+Re8 13.Nf1 Bf8 14.Ng3 g6 15.a4 c5 16.d5 c4 17.Bg5 h6 18.Be3 Nc5 19.Qd2 h5 20.Bg5
+$6 Be7 1-0
+`
+    assert.Equal(t, expected, game.PGN())
+}
+
+func TestWritePGN_02(t *testing.T) {
+    // seven tag roster defaults, start position, promotion and mate
+    game := &Game{Root: &Node{Board: NewBitBoard(NewFen("7k/1P6/6K1/8/8/8/8/8 w - - 0 60"))}, Result: "1-0"}
+    game.SetTag("Annotator", "harpa")
+    node := game.Root
+    for _, san := range []string{"b8=Q#"} {
+        move, _ := node.Board.ParseSAN(san)
+        node = node.AddChild(move)
+    }
+
+    expected := `[Event "?"]
+[Site "?"]
+[Date "????.??.??"]
+[Round "?"]
+[White "?"]
+[Black "?"]
+[Result "1-0"]
+[SetUp "1"]
+[FEN "7k/1P6/6K1/8/8/8/8/8 w - - 0 60"]
+[Annotator "harpa"]
+
+60.b8=Q# 1-0
+`
+    assert.Equal(t, expected, game.PGN())
+}
+
+func TestWritePGN_roundtrip_01(t *testing.T) {
+    games, _ := ParsePGN(strings.NewReader(PGN_SAMPLE))
+    games[0].MainLine()[5].Eval = &Score{Value: -120}
+
+    var text strings.Builder
+    assert.Nil(t, WritePGNGames(&text, games))
+    again, err := ParsePGN(strings.NewReader(text.String()))
+    assert.Nil(t, err)
+    assert.Equal(t, 2, len(again))
+    assert.Equal(t, text.String(), again[0].PGN() + "\n" + again[1].PGN())
+    assert.Equal(t, &Score{Value: -120}, again[0].MainLine()[5].Eval)
+    assert.Equal(t, "", again[0].MainLine()[5].Comment)
+}
+
+func TestExtractPgnEval_01(t *testing.T) {
+    comment, score := extractPgnEval("[%eval -0.35] a good move")
+    assert.Equal(t, "a good move", comment)
+    assert.Equal(t, &Score{Value: -35}, score)
+
+    comment, score = extractPgnEval("mate follows [%eval #4]")
+    assert.Equal(t, "mate follows", comment)
+    assert.Equal(t, &Score{Mate: true, Value: 4}, score)
+
+    comment, score = extractPgnEval("no eval")
+    assert.Equal(t, "no eval", comment)
+    assert.Nil(t, score)
+}
+
+func TestPgnLineWriter_01(t *testing.T) {
+    pw := &pgnLineWriter{}
+    for i := 0; i < 7; i++ {
+        pw.word("123456789")
+    }
+    pw.word("1234567890")
+    assert.Equal(t, 80, len(pw.current))
+    // the closing parenthesis doesn't fit, it goes to the next line with its move
+    pw.suffix(")")
+    pw.suffix(")")
+    assert.Equal(t, strings.Repeat("123456789 ", 7)[:69] + "\n1234567890))", pw.String())
+}
@@ -7,10 +7,15 @@ package main
 
 import (
 	"bufio"
+	"errors"
 	"io"
 	"log"
+	"os"
     "os/exec"
+	"strings"
+	"sync"
 	"syscall"
+	"time"
 )
 
 type LaunchedProcess struct {
@@ -20,9 +25,10 @@ type LaunchedProcess struct {
 	stderr io.ReadCloser
 }
 
-func launchCmd(commandName string, commandArgs []string, env []string) (*LaunchedProcess, error) {
+func launchCmd(commandName string, commandArgs []string, env []string, dir string) (*LaunchedProcess, error) {
 	cmd := exec.Command(commandName, commandArgs...)
 	cmd.Env = env
+	cmd.Dir = dir
 
 	stdout, err := cmd.StdoutPipe()
 	if err != nil {
@@ -47,106 +53,239 @@ func launchCmd(commandName string, commandArgs []string, env []string) (*Launche
 	return &LaunchedProcess{cmd, stdin, stdout, stderr}, err
 }
 
-func NewProcessEndpoint(command string) *ProcessEndpoint {
+func NewProcessEndpoint(config *EngineConfig) (*ProcessEndpoint, error) {
 
-    process, _ := launchCmd(command, []string{}, []string{})
+    process, err := launchCmd(config.Path, config.Args, config.Environ(), config.Dir)
+    if err != nil {
+        return nil, err
+    }
 
 	return &ProcessEndpoint{
 		process:    process,
 		bufferedIn: bufio.NewWriter(process.stdin),
 		output:     make(chan string),
 		input:      make(chan string),
-		err:        make(chan bool),
-    }
+		err:        make(chan bool, 1),
+		shutdownTimeout: config.ShutdownTimeout(),
+		done:       make(chan struct{}),
+		exited:     make(chan struct{}),
+		stdoutDone: make(chan struct{}),
+		stderrDone: make(chan struct{}),
+    }, nil
 }
 
+// STDERR_LINES is the number of stderr lines kept to explain a crash
+const STDERR_LINES = 10
+
 type ProcessEndpoint struct {
 	process    *LaunchedProcess
 	bufferedIn *bufio.Writer
 	output     chan string
 	input      chan string
-	err        chan bool
+	err        chan bool // signals that the process has closed its output
 	//log        *LogScope
+
+	shutdownTimeout time.Duration // the time the process gets for every step of Terminate
+	done       chan struct{}     // closed by Terminate, the goroutines stop passing messages
+	exited     chan struct{}     // closed when the process is reaped
+	stdoutDone chan struct{}
+	stderrDone chan struct{}
+	inMu       sync.Mutex // guards bufferedIn
+	terminateOnce sync.Once
+	waitOnce   sync.Once
+
+	mu         sync.Mutex
+	started    bool
+	stderr     []string // the last lines the process wrote to stderr
+	state      *os.ProcessState
+	waitErr    error
 }
 
 func (pe *ProcessEndpoint) Output() chan string { return pe.output }
 func (pe *ProcessEndpoint) Input() chan string { return pe.input }
 func (pe *ProcessEndpoint) Err() chan bool { return pe.err }
 
+// Exited is closed when the process has ended and is reaped
+func (pe *ProcessEndpoint) Exited() <-chan struct{} { return pe.exited }
+
+// Terminate shuts the engine down in order: it is asked to "stop" and "quit",
+// when it doesn't exit in time it gets SIGTERM and at last SIGKILL.
+// Terminate can be called several times, every call returns after the process has ended.
 func (pe *ProcessEndpoint) Terminate() {
-	pe.process.stdin.Close()
+	pe.terminateOnce.Do(func() {
+		pe.startWait()
+		close(pe.done)
+		// a hung engine may not read its input, the writes must not hold up the signals
+		written := make(chan struct{})
+		go func() {
+			defer close(written)
+			pe.write("stop")
+			pe.write("quit")
+			pe.inMu.Lock()
+			pe.process.stdin.Close()
+			pe.inMu.Unlock()
+		}()
 
-	err := pe.process.cmd.Process.Signal(syscall.SIGINT)
-	if err != nil {
-		//pe.log.Debug("process", "Failed to Interrupt process %v: %s, attempting to kill", pe.process.cmd.Process.Pid, err)
-		err = pe.process.cmd.Process.Kill()
-		if err != nil {
-			log.Printf("Failed to Kill process %v: %s\n", pe.process.cmd.Process.Pid, err)
-			//pe.log.Debug("process", "Failed to Kill process %v: %s", pe.process.cmd.Process.Pid, err)
+		pid := pe.process.cmd.Process.Pid
+		if !pe.waitExit() {
+			log.Printf("process: %v did not quit, sending SIGTERM", pid)
+			pe.process.cmd.Process.Signal(syscall.SIGTERM)
+			if !pe.waitExit() {
+				log.Printf("process: %v did not terminate, killing it", pid)
+				if err := pe.process.cmd.Process.Kill(); err != nil {
+					log.Printf("Failed to Kill process %v: %s\n", pid, err)
+				}
+			}
 		}
+		<-pe.exited
+		// a write stuck in a full pipe returns when the pipe is closed
+		pe.process.stdin.Close()
+		<-written
+
+		// the pipes are at their end when the process is gone, unless a child process still holds them
+		pe.mu.Lock()
+		readers := []chan struct{}{}
+		if pe.started {
+			readers = append(readers, pe.stdoutDone, pe.stderrDone)
+		}
+		pe.mu.Unlock()
+		for _, readerDone := range readers {
+			select {
+			case <-readerDone:
+			case <-time.After(pe.shutdownTimeout):
+			}
+		}
+		pe.process.stdout.Close()
+		pe.process.stderr.Close()
+	})
+	<-pe.exited
+}
+
+// waitExit waits until the process has exited, at most the shutdown timeout
+func (pe *ProcessEndpoint) waitExit() bool {
+	select {
+	case <-pe.exited:
+		return true
+	case <-time.After(pe.shutdownTimeout):
+		return false
 	}
+}
 
-	pe.process.cmd.Wait()
-	if err != nil {
-		log.Printf("Failed to reap process %v: %s\n", pe.process.cmd.Process.Pid, err)
-		//pe.log.Debug("process", "Failed to reap process %v: %s", pe.process.cmd.Process.Pid, err)
+// startWait reaps the process as soon as it exits. The pipes are closed by the readers,
+// that's why os.Process.Wait is used instead of exec.Cmd.Wait.
+func (pe *ProcessEndpoint) startWait() {
+	pe.waitOnce.Do(func() {
+		go func() {
+			state, err := pe.process.cmd.Process.Wait()
+			pe.mu.Lock()
+			pe.state, pe.waitErr = state, err
+			pe.mu.Unlock()
+			close(pe.exited)
+		}()
+	})
+}
+
+// ExitReason tells how the process ended, e.g. "exit status 1" or "signal: segmentation fault"
+func (pe *ProcessEndpoint) ExitReason() string {
+	pe.mu.Lock()
+	defer pe.mu.Unlock()
+	if pe.waitErr != nil {
+		return pe.waitErr.Error()
+	}
+	if pe.state == nil {
+		return "running"
 	}
+	if pe.state.Success() {
+		return "exited"
+	}
+	return pe.state.String()
+}
+
+// Stderr returns the last lines the process wrote to stderr
+func (pe *ProcessEndpoint) Stderr() string {
+	pe.mu.Lock()
+	defer pe.mu.Unlock()
+	return strings.Join(pe.stderr, "\n")
 }
 
 func (pe *ProcessEndpoint) Start() {
+	pe.mu.Lock()
+	pe.started = true
+	pe.mu.Unlock()
+	pe.startWait()
 	go pe.log_stderr()
 	go pe.process_stdout()
 	go pe.process_stdin()
 }
 
+// write sends a line to the process, errors of a closed pipe are ignored
+func (pe *ProcessEndpoint) write(msg string) {
+	pe.inMu.Lock()
+	defer pe.inMu.Unlock()
+	pe.bufferedIn.WriteString(msg)
+	pe.bufferedIn.WriteString("\n")
+	pe.bufferedIn.Flush()
+}
+
 func (pe *ProcessEndpoint) process_stdin() {
-    for msg := range pe.input {
-        pe.bufferedIn.WriteString(msg)
-        pe.bufferedIn.WriteString("\n")
-        pe.bufferedIn.Flush()
-    }
-	close(pe.input)
+	for {
+		select {
+		case msg := <-pe.input:
+			pe.write(msg)
+		case <-pe.done:
+			return
+		}
+	}
 }
 
 func (pe *ProcessEndpoint) process_stdout() {
+	defer close(pe.stdoutDone)
+	defer close(pe.output)
 	bufin := bufio.NewReader(pe.process.stdout)
 	for {
 		str, err := bufin.ReadString('\n')
 		if err != nil {
-			if err != io.EOF {
-                log.Println("process: Unexpected error while reading STDOUT from process: %s", err)
-                panic(err)
+			if err != io.EOF && !errors.Is(err, os.ErrClosed) {
+				log.Printf("process: Unexpected error while reading STDOUT from process: %s\n", err)
 			} else {
-                log.Println("process: Process STDOUT closed")
-                pe.Terminate()
-                pe.err <- true
-                //panic(err)
+				log.Println("process: Process STDOUT closed")
+			}
+			// a crashing process has its last words on stderr
+			select {
+			case <-pe.stderrDone:
+			case <-time.After(time.Second):
 			}
-			break
+			pe.err <- true
+			return
+		}
+		select {
+		case pe.output <- trimEOL(str):
+		case <-pe.done:
+			return
 		}
-		pe.output <- trimEOL(str)
 	}
-	close(pe.output)
 }
 
 func (pe *ProcessEndpoint) log_stderr() {
+	defer close(pe.stderrDone)
 	bufstderr := bufio.NewReader(pe.process.stderr)
 	for {
-		//str, err := bufstderr.ReadString('\n')
 		str, err := bufstderr.ReadString('\n')
-        log.Println("stderr")
-        log.Println(str)
+		if line := trimEOL(str); line != "" {
+			log.Println("stderr:", line)
+			pe.mu.Lock()
+			pe.stderr = append(pe.stderr, line)
+			if len(pe.stderr) > STDERR_LINES {
+				pe.stderr = pe.stderr[1:]
+			}
+			pe.mu.Unlock()
+		}
 		if err != nil {
-			if err != io.EOF {
-                panic(err)
-				//pe.log.Error("process", "Unexpected error while reading STDERR from process: %s", err)
-			} else {
-                pe.err <- true
-				//pe.log.Debug("process", "Process STDERR closed")
+			if err != io.EOF && !errors.Is(err, os.ErrClosed) {
+				log.Printf("process: Unexpected error while reading STDERR from process: %s\n", err)
 			}
-			break
+			return
 		}
-		//pe.log.Error("stderr", "%s", trimEOL(str))
 	}
 }
 
@@ -0,0 +1,96 @@
+package main
+
+
+import (
+    "io/ioutil"
+    "path/filepath"
+    "strings"
+    "testing"
+    "time"
+    "github.com/stretchr/testify/assert"
+)
+
+// stubbornEngine ignores quit, with trap it also ignores SIGTERM
+func stubbornEngineConfig(t *testing.T, trap string) *EngineConfig {
+    path := filepath.Join(t.TempDir(), "stubborn-engine")
+    script := "#!/bin/sh\n" + trap + "\nwhile true; do sleep 0.05; done\n"
+    assert.Nil(t, ioutil.WriteFile(path, []byte(script), 0755))
+    return &EngineConfig{Name: "stubborn", Path: path, ShutdownTimeoutMs: 100}
+}
+
+// assertEnded checks that the process is reaped and the reading goroutines have finished
+func assertEnded(t *testing.T, pe *ProcessEndpoint) {
+    for _, done := range []<-chan struct{}{pe.Exited(), pe.stdoutDone, pe.stderrDone} {
+        select {
+        case <-done:
+        case <-time.After(time.Second):
+            t.Fatal("the process endpoint has not ended")
+        }
+    }
+}
+
+func TestProcessEndpoint_Terminate_01(t *testing.T) {
+    // the engine quits when it is asked to
+    pe, err := NewProcessEndpoint(fakeEngineConfig(t, "fake", "0"))
+    assert.Nil(t, err)
+    pe.Start()
+    pe.Input() <- "isready"
+    assert.Equal(t, "readyok", <-pe.Output())
+
+    start := time.Now()
+    pe.Terminate()
+    assert.True(t, time.Since(start) < DEFAULT_SHUTDOWN_TIMEOUT)
+    assert.Equal(t, "exited", pe.ExitReason())
+    assertEnded(t, pe)
+
+    // a second Terminate does nothing
+    pe.Terminate()
+}
+
+func TestProcessEndpoint_Terminate_02(t *testing.T) {
+    // an engine that ignores quit gets SIGTERM
+    pe, err := NewProcessEndpoint(stubbornEngineConfig(t, ""))
+    assert.Nil(t, err)
+    pe.Start()
+    pe.Terminate()
+    assert.Equal(t, "signal: terminated", pe.ExitReason())
+    assertEnded(t, pe)
+}
+
+func TestProcessEndpoint_Terminate_03(t *testing.T) {
+    // an engine that ignores SIGTERM is killed
+    pe, err := NewProcessEndpoint(stubbornEngineConfig(t, "trap '' TERM"))
+    assert.Nil(t, err)
+    pe.Start()
+    pe.Terminate()
+    assert.Equal(t, "signal: killed", pe.ExitReason())
+    assertEnded(t, pe)
+}
+
+func TestProcessEndpoint_Terminate_04(t *testing.T) {
+    // Terminate before Start and while nobody reads the output
+    pe, err := NewProcessEndpoint(fakeEngineConfig(t, "fake", "0"))
+    assert.Nil(t, err)
+    pe.Terminate()
+    assert.Equal(t, "exited", pe.ExitReason())
+
+    pe, _ = NewProcessEndpoint(fakeEngineConfig(t, "fake", "0"))
+    pe.Start()
+    pe.Input() <- "uci"
+    pe.Terminate()
+    assertEnded(t, pe)
+}
+
+func TestProcessEndpoint_Terminate_05(t *testing.T) {
+    // an engine that doesn't read its input is killed although the pipe is full
+    pe, err := NewProcessEndpoint(stubbornEngineConfig(t, "trap '' TERM"))
+    assert.Nil(t, err)
+    pe.Start()
+    pe.Input() <- strings.Repeat("x", 1 << 20)
+
+    start := time.Now()
+    pe.Terminate()
+    assert.True(t, time.Since(start) < time.Second)
+    assert.Equal(t, "signal: killed", pe.ExitReason())
+    assertEnded(t, pe)
+}
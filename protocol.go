@@ -0,0 +1,374 @@
+package main
+
+
+import (
+    "encoding/json"
+    "fmt"
+    "strings"
+    "time"
+)
+
+// The websocket speaks json. Every message is an envelope with the protocol version, a type,
+// an optional id that is echoed in the error replies to the message, the engine the message
+// is for or from, and a payload depending on the type. Example:
+//   {"v": 1, "type": "analyze", "id": "7", "payload": {"depth": 20, "multipv": 3}}
+const PROTOCOL_VERSION = 1
+
+// the messages of the client
+const (
+    MSG_SET_POSITION = "setPosition"
+    MSG_ANALYZE = "analyze"
+    MSG_STOP = "stop"
+    MSG_SET_OPTION = "setOption"
+    MSG_GET_OPTIONS = "getOptions"
+    MSG_UCI = "uci" // raw uci in both directions, for power users and for lines the protocol doesn't know
+    MSG_REPORT = "report" // the report of an analyzed game in both directions, it needs no engine
+)
+
+// the messages of the server
+const (
+    MSG_ANALYSIS_UPDATE = "analysisUpdate"
+    MSG_BEST_MOVE = "bestMove"
+    MSG_ENGINE_ERROR = "engineError"
+    MSG_OPTIONS = "options"
+    MSG_ERROR = "error"
+    MSG_ROOM = "room"
+    MSG_SESSION = "session"
+)
+
+type Envelope struct {
+    Version int `json:"v"`
+    Type string `json:"type"`
+    ID string `json:"id,omitempty"`
+    Engine string `json:"engine,omitempty"` // only for the named engine, all engines if empty
+    Payload json.RawMessage `json:"payload,omitempty"`
+}
+
+type SetPositionPayload struct {
+    Fen string `json:"fen,omitempty"` // the start position if empty
+    Moves []string `json:"moves,omitempty"`
+}
+
+type AnalyzePayload struct {
+    Depth int `json:"depth,omitempty"`
+    Nodes int64 `json:"nodes,omitempty"`
+    MoveTime int64 `json:"movetime,omitempty"` // milliseconds
+    Mate int `json:"mate,omitempty"`
+    Infinite bool `json:"infinite,omitempty"` // also without any limit
+    MultiPV int `json:"multipv,omitempty"` // sets the option MultiPV for the search, it isn't stored
+}
+
+type SetOptionPayload struct {
+    Name string `json:"name"`
+    Value string `json:"value,omitempty"` // empty for buttons
+}
+
+type UciPayload struct {
+    Line string `json:"line"`
+}
+
+type AnalysisUpdatePayload struct {
+    Depth int `json:"depth"`
+    SelDepth int `json:"seldepth,omitempty"`
+    Nodes int64 `json:"nodes,omitempty"`
+    NPS int64 `json:"nps,omitempty"`
+    Time int `json:"time,omitempty"` // milliseconds
+    HashFull int `json:"hashfull,omitempty"`
+    TBHits int64 `json:"tbhits,omitempty"`
+    Lines []LinePayload `json:"lines"` // ordered by rank, the best line first
+}
+
+type LinePayload struct {
+    Rank int `json:"rank"`
+    Depth int `json:"depth"`
+    Score *ScorePayload `json:"score,omitempty"`
+    PV []string `json:"pv"`
+    SAN string `json:"san"` // the pv in human readable format
+}
+
+// ScorePayload is seen from the side to move, either cp or mate is set
+type ScorePayload struct {
+    CP *int `json:"cp,omitempty"`
+    Mate *int `json:"mate,omitempty"`
+    Bound string `json:"bound,omitempty"` // "lower" or "upper", empty for an exact score
+}
+
+type BestMovePayload struct {
+    Move string `json:"move"`
+    Ponder string `json:"ponder,omitempty"`
+}
+
+type EngineErrorPayload struct {
+    Kind string `json:"kind"`
+    Reason string `json:"reason"`
+    Stderr string `json:"stderr,omitempty"`
+    Restart int `json:"restart"` // the number of the following restart, 0 when the engine is given up
+    RestartIn int64 `json:"restartIn,omitempty"` // milliseconds
+    Message string `json:"message"`
+}
+
+type OptionsPayload struct {
+    Options []*UciOption `json:"options"`
+}
+
+type ErrorPayload struct {
+    Message string `json:"message"`
+}
+
+// MAX_REPORT_PGN is the largest PGN a report is made of, a long game with comments has some 30 kilobytes
+const MAX_REPORT_PGN = 256 << 10
+
+// ReportRequestPayload asks for the report of the first game of a PGN with %eval comments
+type ReportRequestPayload struct {
+    PGN string `json:"pgn"`
+}
+
+// RoomPayload tells a member of a shared room who is there and whether the member steers the engines
+type RoomPayload struct {
+    Name string `json:"name"`
+    Owner bool `json:"owner"`
+    Members int `json:"members"`
+}
+
+// DecodeEnvelope reads a message of the client
+func DecodeEnvelope(data string) (*Envelope, error) {
+    env := &Envelope{}
+    if err := json.Unmarshal([]byte(data), env); err != nil {
+        return nil, fmt.Errorf("invalid message: %s", err)
+    }
+    if env.Version != PROTOCOL_VERSION {
+        return env, fmt.Errorf("unsupported protocol version %d, expected %d", env.Version, PROTOCOL_VERSION)
+    }
+    return env, nil
+}
+
+// decodePayload reads the payload of a message, a missing payload leaves v empty
+func (env *Envelope) decodePayload(v interface{}) error {
+    if len(env.Payload) == 0 {
+        return nil
+    }
+    if err := json.Unmarshal(env.Payload, v); err != nil {
+        return fmt.Errorf("invalid payload of %s: %s", env.Type, err)
+    }
+    return nil
+}
+
+// Commands translates a message of the client into the commands for the engine
+func (env *Envelope) Commands() ([]string, error) {
+    switch env.Type {
+    case MSG_SET_POSITION:
+        payload := SetPositionPayload{}
+        if err := env.decodePayload(&payload); err != nil {
+            return nil, err
+        }
+        position := Position{Fen: payload.Fen, Moves: payload.Moves}
+        if _, err := position.Board(); err != nil {
+            return nil, err
+        }
+        return []string{position.Command()}, nil
+    case MSG_ANALYZE:
+        payload := AnalyzePayload{}
+        if err := env.decodePayload(&payload); err != nil {
+            return nil, err
+        }
+        cmds := []string{}
+        if payload.MultiPV > 0 {
+            cmds = append(cmds, fmt.Sprintf("multipv %d", payload.MultiPV))
+        }
+        limits := Limits{
+            Depth: payload.Depth,
+            Nodes: payload.Nodes,
+            MoveTime: time.Duration(payload.MoveTime) * time.Millisecond,
+            Mate: payload.Mate,
+            Infinite: payload.Infinite,
+        }
+        return append(cmds, limits.Command()), nil
+    case MSG_STOP:
+        return []string{"stop"}, nil
+    case MSG_SET_OPTION:
+        payload := SetOptionPayload{}
+        if err := env.decodePayload(&payload); err != nil {
+            return nil, err
+        }
+        if payload.Name == "" {
+            return nil, fmt.Errorf("setOption without a name")
+        }
+        if payload.Value == "" {
+            return []string{"setoption name " + payload.Name}, nil
+        }
+        return []string{fmt.Sprintf("setoption name %s value %s", payload.Name, payload.Value)}, nil
+    case MSG_GET_OPTIONS:
+        return []string{"options"}, nil
+    case MSG_UCI:
+        payload := UciPayload{}
+        if err := env.decodePayload(&payload); err != nil {
+            return nil, err
+        }
+        return []string{payload.Line}, nil
+    }
+    return nil, fmt.Errorf("unknown message type '%s'", env.Type)
+}
+
+// NewEnvelope packs a payload, the error is only possible for payloads that can't be json
+func NewEnvelope(msgType, engine string, payload interface{}) (*Envelope, error) {
+    bytes, err := json.Marshal(payload)
+    if err != nil {
+        return nil, err
+    }
+    return &Envelope{Version: PROTOCOL_VERSION, Type: msgType, Engine: engine, Payload: bytes}, nil
+}
+
+// Encode gives the message as json text
+func (env *Envelope) Encode() string {
+    bytes, err := json.Marshal(env)
+    if err != nil {
+        // the payload is json already, the rest are strings
+        panic(err)
+    }
+    return string(bytes)
+}
+
+// ErrorMessage is the reply to a message that could not be handled, request is nil if it wasn't json
+func ErrorMessage(request *Envelope, err error) string {
+    env, _ := NewEnvelope(MSG_ERROR, "", ErrorPayload{err.Error()})
+    if request != nil {
+        env.ID, env.Engine = request.ID, request.Engine
+    }
+    return env.Encode()
+}
+
+// SessionPayload is the first message in a room. The client resumes the session with the id,
+// then it gets the position and the newest lines of the session.
+type SessionPayload struct {
+    ID string `json:"id"`
+    Resumed bool `json:"resumed"`
+    Position *SetPositionPayload `json:"position,omitempty"` // nil before a position was set
+}
+
+// SessionMessage tells a member which session it is in
+func SessionMessage(id string, resumed bool, position *Position) string {
+    payload := SessionPayload{ID: id, Resumed: resumed}
+    if position != nil {
+        payload.Position = &SetPositionPayload{position.Fen, position.Moves}
+    }
+    env, _ := NewEnvelope(MSG_SESSION, "", payload)
+    return env.Encode()
+}
+
+// RoomMessage is sent to every member when somebody joins or leaves a room
+func RoomMessage(name string, owner bool, members int) string {
+    env, _ := NewEnvelope(MSG_ROOM, "", RoomPayload{name, owner, members})
+    return env.Encode()
+}
+
+// ReportMessage answers a report message with the GameReport of its PGN
+func ReportMessage(request *Envelope) string {
+    payload := ReportRequestPayload{}
+    if err := request.decodePayload(&payload); err != nil {
+        return ErrorMessage(request, err)
+    }
+    if len(payload.PGN) > MAX_REPORT_PGN {
+        return ErrorMessage(request, fmt.Errorf("the pgn has more than %d bytes", MAX_REPORT_PGN))
+    }
+    games, err := ParsePGN(strings.NewReader(payload.PGN))
+    if err != nil {
+        return ErrorMessage(request, err)
+    }
+    if len(games) == 0 {
+        return ErrorMessage(request, fmt.Errorf("the pgn has no game"))
+    }
+    report, err := NewGameReport(games[0])
+    if err != nil {
+        return ErrorMessage(request, err)
+    }
+    env, _ := NewEnvelope(MSG_REPORT, "", report)
+    env.ID = request.ID
+    return env.Encode()
+}
+
+// OutputMessage translates the output of an engine into a message for the client.
+// Lines that have no message of their own are passed as raw uci.
+func OutputMessage(engine string, output *EngineOutput) string {
+    msgType, payload := outputPayload(output)
+    env, err := NewEnvelope(msgType, engine, payload)
+    if err != nil {
+        return ErrorMessage(&Envelope{Engine: engine}, err)
+    }
+    return env.Encode()
+}
+
+func outputPayload(output *EngineOutput) (string, interface{}) {
+    switch {
+    case output.Error != nil:
+        e := output.Error
+        return MSG_ENGINE_ERROR, EngineErrorPayload{
+            Kind: e.Kind,
+            Reason: e.Reason,
+            Stderr: e.Stderr,
+            Restart: e.Restart,
+            RestartIn: e.RestartIn.Milliseconds(),
+            Message: e.Error(),
+        }
+    case output.Failure != nil:
+        return MSG_ERROR, ErrorPayload{output.Failure.Error()}
+    case output.Options != nil:
+        return MSG_OPTIONS, OptionsPayload{output.Options}
+    case output.PrettyLine != "":
+        return MSG_ANALYSIS_UPDATE, analysisUpdate(output)
+    }
+    if strings.HasPrefix(output.Raw, "bestmove") {
+        bestMove := parseBestMove(output.Raw)
+        return MSG_BEST_MOVE, BestMovePayload{bestMove.Move, bestMove.Ponder}
+    }
+    return MSG_UCI, UciPayload{output.Raw}
+}
+
+// analysisUpdate has the ranked lines of a multipv search or else the line of the output itself
+func analysisUpdate(output *EngineOutput) AnalysisUpdatePayload {
+    info := output.Info
+    lines := output.Lines
+    if len(lines) == 0 {
+        lines = []*EngineOutput{output}
+    }
+    payload := AnalysisUpdatePayload{
+        Depth: info.Depth,
+        SelDepth: info.SelDepth,
+        Nodes: info.Nodes,
+        NPS: info.NPS,
+        Time: info.Time,
+        HashFull: info.HashFull,
+        TBHits: info.TBHits,
+        Lines: []LinePayload{},
+    }
+    for _, line := range lines {
+        payload.Lines = append(payload.Lines, LinePayload{
+            Rank: line.Info.Rank(),
+            Depth: line.Info.Depth,
+            Score: scorePayload(line.Info.Score),
+            PV: line.Info.PV,
+            SAN: line.PrettyLine,
+        })
+    }
+    return payload
+}
+
+func scorePayload(score *Score) *ScorePayload {
+    if score == nil {
+        return nil
+    }
+    value := score.Value
+    payload := &ScorePayload{}
+    if score.Mate {
+        payload.Mate = &value
+    } else {
+        payload.CP = &value
+    }
+    switch score.Bound {
+    case LOWER_BOUND:
+        payload.Bound = "lower"
+    case UPPER_BOUND:
+        payload.Bound = "upper"
+    }
+    return payload
+}
+
@@ -0,0 +1,110 @@
+package main
+
+
+import (
+    "testing"
+    "time"
+    "github.com/stretchr/testify/assert"
+)
+
+func commands(t *testing.T, msg string) ([]string, error) {
+    env, err := DecodeEnvelope(msg)
+    assert.Nil(t, err)
+    return env.Commands()
+}
+
+func TestEnvelope_Commands_01(t *testing.T) {
+    cmds, err := commands(t, `{"v":1,"type":"setPosition","payload":{"moves":["e2e4","e7e5"]}}`)
+    assert.Nil(t, err)
+    assert.Equal(t, []string{"position startpos moves e2e4 e7e5"}, cmds)
+
+    cmds, err = commands(t, `{"v":1,"type":"analyze","payload":{"depth":20,"multipv":3}}`)
+    assert.Nil(t, err)
+    assert.Equal(t, []string{"multipv 3", "go depth 20"}, cmds)
+
+    cmds, err = commands(t, `{"v":1,"type":"analyze","payload":{"movetime":1500}}`)
+    assert.Nil(t, err)
+    assert.Equal(t, []string{"go movetime 1500"}, cmds)
+
+    cmds, err = commands(t, `{"v":1,"type":"analyze"}`)
+    assert.Nil(t, err)
+    assert.Equal(t, []string{"go infinite"}, cmds)
+
+    cmds, err = commands(t, `{"v":1,"type":"setOption","payload":{"name":"Hash","value":"128"}}`)
+    assert.Nil(t, err)
+    assert.Equal(t, []string{"setoption name Hash value 128"}, cmds)
+
+    cmds, err = commands(t, `{"v":1,"type":"setOption","payload":{"name":"Clear Hash"}}`)
+    assert.Nil(t, err)
+    assert.Equal(t, []string{"setoption name Clear Hash"}, cmds)
+
+    cmds, err = commands(t, `{"v":1,"type":"uci","payload":{"line":"d"}}`)
+    assert.Nil(t, err)
+    assert.Equal(t, []string{"d"}, cmds)
+}
+
+func TestEnvelope_Commands_error_01(t *testing.T) {
+    // the position is checked before it goes to the engine
+    _, err := commands(t, `{"v":1,"type":"setPosition","payload":{"moves":["e2e5"]}}`)
+    assert.EqualError(t, err, "position: illegal move e2e5 in " + STARTPOSITION)
+
+    _, err = commands(t, `{"v":1,"type":"setPosition","payload":{"fen":"8/8 w"}}`)
+    assert.NotNil(t, err)
+
+    _, err = commands(t, `{"v":1,"type":"analyze","payload":{"depth":"deep"}}`)
+    assert.NotNil(t, err)
+
+    _, err = commands(t, `{"v":1,"type":"setOption","payload":{}}`)
+    assert.EqualError(t, err, "setOption without a name")
+
+    _, err = commands(t, `{"v":1,"type":"castle"}`)
+    assert.EqualError(t, err, "unknown message type 'castle'")
+}
+
+func TestDecodeEnvelope_error_01(t *testing.T) {
+    env, err := DecodeEnvelope(`go infinite`)
+    assert.Nil(t, env)
+    assert.NotNil(t, err)
+
+    env, err = DecodeEnvelope(`{"v":2,"type":"stop","id":"a"}`)
+    assert.EqualError(t, err, "unsupported protocol version 2, expected 1")
+    assert.Equal(t, `{"v":1,"type":"error","id":"a","payload":{"message":"unsupported protocol version 2, expected 1"}}`,
+        ErrorMessage(env, err))
+}
+
+func TestOutputMessage_01(t *testing.T) {
+    as := NewAnalysisState(STARTPOSITION)
+    output := NewEngineOutput("info depth 12 seldepth 15 multipv 2 score cp -13 upperbound nodes 5000 nps 250000 time 20 pv e2e4 e7e5", as)
+    assert.Equal(t,
+        `{"v":1,"type":"analysisUpdate","engine":"sf","payload":{"depth":12,"seldepth":15,"nodes":5000,"nps":250000,"time":20,` +
+        `"lines":[{"rank":2,"depth":12,"score":{"cp":-13,"bound":"upper"},"pv":["e2e4","e7e5"],"san":"1.e4 e5"}]}}`,
+        OutputMessage("sf", output))
+
+    output = NewEngineOutput("info depth 3 score mate -2 pv g2g4", as)
+    assert.Contains(t, OutputMessage("sf", output), `"score":{"mate":-2}`)
+
+    output = NewEngineOutput("bestmove e2e4 ponder e7e5", as)
+    assert.Equal(t, `{"v":1,"type":"bestMove","engine":"sf","payload":{"move":"e2e4","ponder":"e7e5"}}`, OutputMessage("sf", output))
+
+    output = NewEngineOutput("info string NNUE enabled", as)
+    assert.Equal(t, `{"v":1,"type":"uci","engine":"sf","payload":{"line":"info string NNUE enabled"}}`, OutputMessage("sf", output))
+}
+
+func TestOutputMessage_multipv_01(t *testing.T) {
+    as := NewAnalysisState(STARTPOSITION)
+    first := NewEngineOutput("info depth 5 multipv 1 score cp 30 pv e2e4", as)
+    second := NewEngineOutput("info depth 5 multipv 2 score cp 25 pv d2d4", as)
+    second.Lines = []*EngineOutput{first, second}
+    assert.Contains(t, OutputMessage("sf", second),
+        `"lines":[{"rank":1,"depth":5,"score":{"cp":30},"pv":["e2e4"],"san":"1.e4"},{"rank":2,"depth":5,"score":{"cp":25},"pv":["d2d4"],"san":"1.d4"}]`)
+}
+
+func TestOutputMessage_engineError_01(t *testing.T) {
+    output := &EngineOutput{Error: &EngineError{
+        Engine: "sf", Kind: ENGINE_CRASHED, Reason: "signal: killed", Restart: 2, RestartIn: time.Second,
+    }}
+    assert.Equal(t,
+        `{"v":1,"type":"engineError","engine":"sf","payload":{"kind":"` + ENGINE_CRASHED + `","reason":"signal: killed",` +
+        `"restart":2,"restartIn":1000,"message":"` + output.Error.Error() + `"}}`,
+        OutputMessage("sf", output))
+}
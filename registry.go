@@ -0,0 +1,127 @@
+package main
+
+
+import (
+    "encoding/json"
+    "fmt"
+    "io/ioutil"
+    "os"
+    "sort"
+    "time"
+)
+
+// EngineConfig describes how to launch an engine
+type EngineConfig struct {
+    Name string                 `json:"name"`
+    Path string                 `json:"path"` // the binary, looked up in PATH if it has no slash
+    Args []string               `json:"args,omitempty"`
+    Dir string                  `json:"dir,omitempty"` // working directory, "" for the current one
+    Env []string                `json:"env,omitempty"` // "KEY=value", added to the environment of harpa
+    Options map[string]string   `json:"options,omitempty"` // uci options set after the handshake
+    ShutdownTimeoutMs int       `json:"shutdown_timeout_ms,omitempty"` // how long the engine may take to quit
+    OutputIntervalMs int        `json:"output_interval_ms,omitempty"` // how often the lines of a search are sent at most
+}
+
+const DEFAULT_SHUTDOWN_TIMEOUT = 2 * time.Second
+const DEFAULT_OUTPUT_INTERVAL = 100 * time.Millisecond
+
+// OutputInterval is the time between two updates of a search, the lines in between are coalesced
+func (c *EngineConfig) OutputInterval() time.Duration {
+    if c.OutputIntervalMs <= 0 {
+        return DEFAULT_OUTPUT_INTERVAL
+    }
+    return time.Duration(c.OutputIntervalMs) * time.Millisecond
+}
+
+// ShutdownTimeout is the time the engine gets to quit before it is terminated, and again before it is killed
+func (c *EngineConfig) ShutdownTimeout() time.Duration {
+    if c.ShutdownTimeoutMs <= 0 {
+        return DEFAULT_SHUTDOWN_TIMEOUT
+    }
+    return time.Duration(c.ShutdownTimeoutMs) * time.Millisecond
+}
+
+// Environ returns the environment of the engine process
+func (c *EngineConfig) Environ() []string {
+    return append(os.Environ(), c.Env...)
+}
+
+// EngineRegistry holds the engines a client can choose from
+type EngineRegistry struct {
+    Default string              `json:"default"` // the engine for clients that don't choose one
+    Engines []*EngineConfig     `json:"engines"`
+}
+
+const ENGINES_FILE = "engines.json"
+
+// DefaultEngineRegistry is used when there is no config file, it only knows stockfish
+func DefaultEngineRegistry() *EngineRegistry {
+    return &EngineRegistry{
+        Default: "stockfish",
+        Engines: []*EngineConfig{{Name: "stockfish", Path: "stockfish"}},
+    }
+}
+
+// LoadEngineRegistry reads the engines from a json file like
+//   {"default": "stockfish", "engines": [{"name": "stockfish", "path": "/usr/bin/stockfish",
+//     "options": {"Hash": "256"}}, {"name": "lc0", "path": "lc0", "args": ["--backend=eigen"]}]}
+func LoadEngineRegistry(path string) (*EngineRegistry, error) {
+    bytes, err := ioutil.ReadFile(path)
+    if err != nil {
+        return nil, err
+    }
+    registry := &EngineRegistry{}
+    if err := json.Unmarshal(bytes, registry); err != nil {
+        return nil, fmt.Errorf("engines %s: %s", path, err)
+    }
+    if err := registry.validate(); err != nil {
+        return nil, fmt.Errorf("engines %s: %s", path, err)
+    }
+    return registry, nil
+}
+
+func (r *EngineRegistry) validate() error {
+    if len(r.Engines) == 0 {
+        return fmt.Errorf("no engines configured")
+    }
+    names := map[string]bool{}
+    for _, config := range r.Engines {
+        if config.Name == "" || config.Path == "" {
+            return fmt.Errorf("every engine needs a name and a path")
+        }
+        if names[config.Name] {
+            return fmt.Errorf("engine '%s' is configured twice", config.Name)
+        }
+        names[config.Name] = true
+    }
+    if r.Default != "" && !names[r.Default] {
+        return fmt.Errorf("default engine '%s' is not configured", r.Default)
+    }
+    return nil
+}
+
+// Engine finds the config of an engine by name, "" gives the default engine
+func (r *EngineRegistry) Engine(name string) (*EngineConfig, error) {
+    if name == "" {
+        name = r.Default
+    }
+    if name == "" {
+        return r.Engines[0], nil
+    }
+    for _, config := range r.Engines {
+        if config.Name == name {
+            return config, nil
+        }
+    }
+    return nil, fmt.Errorf("unknown engine '%s'", name)
+}
+
+// Names returns the names of all engines in alphabetical order
+func (r *EngineRegistry) Names() []string {
+    names := []string{}
+    for _, config := range r.Engines {
+        names = append(names, config.Name)
+    }
+    sort.Strings(names)
+    return names
+}
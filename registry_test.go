@@ -0,0 +1,56 @@
+package main
+
+
+import (
+    "io/ioutil"
+    "os"
+    "path/filepath"
+    "testing"
+    "github.com/stretchr/testify/assert"
+)
+
+func writeEngines(t *testing.T, content string) string {
+    path := filepath.Join(t.TempDir(), ENGINES_FILE)
+    assert.Nil(t, ioutil.WriteFile(path, []byte(content), 0644))
+    return path
+}
+
+func TestLoadEngineRegistry_01(t *testing.T) {
+    path := writeEngines(t, `{"default": "sf", "engines": [
+        {"name": "sf", "path": "/usr/games/stockfish", "options": {"Hash": "256"}},
+        {"name": "lc0", "path": "lc0", "args": ["--backend=eigen"], "dir": "/opt/lc0", "env": ["OMP_NUM_THREADS=2"]}]}`)
+
+    registry, err := LoadEngineRegistry(path)
+    assert.Nil(t, err)
+    assert.Equal(t, []string{"lc0", "sf"}, registry.Names())
+
+    config, err := registry.Engine("")
+    assert.Nil(t, err)
+    assert.Equal(t, "/usr/games/stockfish", config.Path)
+    assert.Equal(t, map[string]string{"Hash": "256"}, config.Options)
+
+    config, err = registry.Engine("lc0")
+    assert.Nil(t, err)
+    assert.Equal(t, []string{"--backend=eigen"}, config.Args)
+    assert.Equal(t, "/opt/lc0", config.Dir)
+    assert.Contains(t, config.Environ(), "OMP_NUM_THREADS=2")
+
+    _, err = registry.Engine("komodo")
+    assert.NotNil(t, err)
+}
+
+func TestLoadEngineRegistry_errors_01(t *testing.T) {
+    for _, content := range []string{
+        `{"engines": []}`,
+        `{"engines": [{"name": "sf"}]}`,
+        `{"engines": [{"name": "sf", "path": "a"}, {"name": "sf", "path": "b"}]}`,
+        `{"default": "lc0", "engines": [{"name": "sf", "path": "a"}]}`,
+        `{"engines": `,
+    } {
+        path := writeEngines(t, content)
+        _, err := LoadEngineRegistry(path)
+        assert.NotNil(t, err, content)
+    }
+    _, err := LoadEngineRegistry("/does/not/exist.json")
+    assert.True(t, os.IsNotExist(err))
+}
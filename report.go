@@ -0,0 +1,187 @@
+package main
+
+
+import (
+    "context"
+    "encoding/json"
+    "flag"
+    "fmt"
+    "log"
+    "math"
+    "os"
+    "strings"
+    "text/tabwriter"
+)
+
+// PlayerReport sums up the moves of one player in an analyzed game
+type PlayerReport struct {
+    Name string `json:"name"`
+    Moves int `json:"moves"` // the moves with an evaluation before and after
+    ACPL float64 `json:"acpl"` // average centipawn loss
+    Inaccuracies int `json:"inaccuracies"`
+    Mistakes int `json:"mistakes"`
+    Blunders int `json:"blunders"`
+    Accuracy float64 `json:"accuracy"` // 0 to 100, the mean accuracy of the moves from the winning chances they lose
+}
+
+// GameReport tells how well both players have played a game
+type GameReport struct {
+    Event string `json:"event,omitempty"`
+    Date string `json:"date,omitempty"`
+    Result string `json:"result"`
+    White PlayerReport `json:"white"`
+    Black PlayerReport `json:"black"`
+}
+
+// winPercent is the chance to win with an evaluation in centipawns, the curve of Lichess
+func winPercent(cp int) float64 {
+    return 50 + 50 * (2 / (1 + math.Exp(-0.00368208 * float64(cp))) - 1)
+}
+
+// moveAccuracy is 100 for a move that keeps the winning chances and falls towards 0 with the chances lost
+func moveAccuracy(winBefore, winAfter float64) float64 {
+    accuracy := 103.1668100711649 * math.Exp(-0.04354415386753951 * (winBefore - winAfter)) - 3.166924740191411
+    return math.Max(0, math.Min(100, accuracy))
+}
+
+// whiteCentipawns is the evaluation of a node for white, a finished game needs none.
+// A draw that could be claimed is no finished game, the evaluation of the position counts.
+func whiteCentipawns(node *Node) (int, bool) {
+    switch node.Board.Status() {
+    case ONGOING:
+    case CHECKMATE:
+        if node.Board.WhiteToMove() {
+            return -MATE_CP, true
+        }
+        return MATE_CP, true
+    default:
+        return 0, true
+    }
+    if node.Eval == nil {
+        return 0, false
+    }
+    return centipawns(node.Eval), true
+}
+
+// NewGameReport computes the average centipawn loss, the inaccuracies, mistakes and blunders and
+// the accuracy of both players from the evaluations of the main line, e.g. from Annotate or a PGN
+// with %eval comments. Moves without an evaluation before and after are left out.
+func NewGameReport(game *Game) (*GameReport, error) {
+    report := &GameReport{Event: game.Tag("Event"), Date: game.Tag("Date"), Result: game.Result}
+    report.White.Name, report.Black.Name = game.Tag("White"), game.Tag("Black")
+    losses := map[*PlayerReport]int{}
+    accuracies := map[*PlayerReport]float64{}
+
+    before, known := whiteCentipawns(game.Root)
+    for _, node := range game.MainLine() {
+        after, knownAfter := whiteCentipawns(node)
+        if known && knownAfter {
+            white := !node.Board.WhiteToMove()
+            player, loss := &report.White, capWinning(before) - capWinning(after)
+            winBefore, winAfter := winPercent(capWinning(before)), winPercent(capWinning(after))
+            if !white {
+                player, loss = &report.Black, -loss
+                winBefore, winAfter = 100 - winBefore, 100 - winAfter
+            }
+            if loss < 0 {
+                loss = 0
+            }
+            player.Moves++
+            losses[player] += loss
+            accuracies[player] += moveAccuracy(winBefore, winAfter)
+            switch nag, _ := judgement(loss); nag {
+            case 6:
+                player.Inaccuracies++
+            case 2:
+                player.Mistakes++
+            case 4:
+                player.Blunders++
+            }
+        }
+        before, known = after, knownAfter
+    }
+
+    if report.White.Moves + report.Black.Moves == 0 {
+        return nil, fmt.Errorf("the game has no analyzed moves")
+    }
+    for _, player := range []*PlayerReport{&report.White, &report.Black} {
+        if player.Moves > 0 {
+            player.ACPL = math.Round(float64(losses[player]) / float64(player.Moves) * 10) / 10
+            player.Accuracy = math.Round(accuracies[player] / float64(player.Moves) * 10) / 10
+        }
+    }
+    return report, nil
+}
+
+// analyzed tells whether every position of the main line has an evaluation
+func analyzed(game *Game) bool {
+    for _, node := range append([]*Node{game.Root}, game.MainLine()...) {
+        if _, ok := whiteCentipawns(node); !ok {
+            return false
+        }
+    }
+    return true
+}
+
+// ReportMain prints the report of every game in a PGN file, games without evaluations are annotated first
+// usage: report [-engine name] [-depth n | -movetime ms] [-json] <games.pgn>
+func ReportMain(args []string) {
+    flags := flag.NewFlagSet("report", flag.ExitOnError)
+    engineName, limits := engineFlags(flags)
+    asJSON := flags.Bool("json", false, "print the reports as json")
+    flags.Parse(args)
+    if flags.NArg() != 1 {
+        fmt.Println("usage: report [-engine name] [-depth n | -movetime ms] [-json] <games.pgn>")
+        return
+    }
+
+    games, err := ReadPGNFile(flags.Arg(0))
+    if err != nil {
+        log.Fatal(err)
+    }
+    unanalyzed := []*Game{}
+    for _, game := range games {
+        if !analyzed(game) {
+            unanalyzed = append(unanalyzed, game)
+        }
+    }
+    if len(unanalyzed) > 0 {
+        config, err := loadEngines().Engine(*engineName)
+        if err != nil {
+            log.Fatal(err)
+        }
+        if err := annotateGames(context.Background(), config, limits(), unanalyzed); err != nil {
+            log.Fatal(err)
+        }
+    }
+
+    reports := []*GameReport{}
+    for _, game := range games {
+        report, err := NewGameReport(game)
+        if err != nil {
+            log.Fatal(err)
+        }
+        reports = append(reports, report)
+    }
+    if *asJSON {
+        encoder := json.NewEncoder(os.Stdout)
+        encoder.SetIndent("", "  ")
+        encoder.Encode(reports)
+        return
+    }
+    table := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', tabwriter.AlignRight)
+    for _, report := range reports {
+        title := fmt.Sprintf("%s - %s %s", report.White.Name, report.Black.Name, report.Result)
+        if report.Event != "" || report.Date != "" {
+            title = strings.TrimSpace(report.Event + " " + report.Date) + ", " + title
+        }
+        fmt.Fprintln(table, title)
+        fmt.Fprintln(table, "\tmoves\tacpl\tinaccuracies\tmistakes\tblunders\taccuracy\t")
+        for _, player := range []PlayerReport{report.White, report.Black} {
+            fmt.Fprintf(table, "%s\t%d\t%.1f\t%d\t%d\t%d\t%.1f\t\n",
+                player.Name, player.Moves, player.ACPL, player.Inaccuracies, player.Mistakes, player.Blunders, player.Accuracy)
+        }
+        fmt.Fprintln(table)
+    }
+    table.Flush()
+}
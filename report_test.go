@@ -0,0 +1,72 @@
+package main
+
+
+import (
+    "context"
+    "encoding/json"
+    "strings"
+    "testing"
+    "github.com/stretchr/testify/assert"
+)
+
+func TestNewGameReport_01(t *testing.T) {
+    games, _ := ParsePGN(strings.NewReader(SCHOLARS_MATE))
+    game := games[0]
+    Annotate(context.Background(), game, SCHOLARS_MATE_EVALUATIONS)
+    // the report reads the evaluations back from the annotated pgn
+    games, _ = ParsePGN(strings.NewReader(game.PGN()))
+
+    report, err := NewGameReport(games[0])
+    assert.Nil(t, err)
+    assert.Equal(t, "A", report.White.Name)
+    assert.Equal(t, 4, report.White.Moves)
+    // only Qh5 loses 10 centipawns
+    assert.Equal(t, 2.5, report.White.ACPL)
+    assert.Equal(t, 0, report.White.Inaccuracies + report.White.Mistakes + report.White.Blunders)
+    assert.Equal(t, 3, report.Black.Moves)
+    // Nf6 allows the mate
+    assert.Equal(t, 326.7, report.Black.ACPL)
+    assert.Equal(t, 1, report.Black.Blunders)
+    assert.True(t, report.White.Accuracy > 95)
+    assert.True(t, report.Black.Accuracy < report.White.Accuracy)
+}
+
+func TestNewGameReport_02(t *testing.T) {
+    games, _ := ParsePGN(strings.NewReader(SCHOLARS_MATE))
+    _, err := NewGameReport(games[0])
+    assert.EqualError(t, err, "the game has no analyzed moves")
+}
+
+func TestWhiteCentipawns_01(t *testing.T) {
+    // a draw that could be claimed needs an evaluation like any other position
+    games, _ := ParsePGN(strings.NewReader("1.Nf3 Nf6 2.Ng1 Ng8 3.Nf3 Nf6 4.Ng1 Ng8 *\n"))
+    last := games[0].MainLine()[7]
+    _, known := whiteCentipawns(last)
+    assert.False(t, known)
+    last.Eval = &Score{Value: 40}
+    cp, known := whiteCentipawns(last)
+    assert.Equal(t, []interface{}{40, true}, []interface{}{cp, known})
+}
+
+func TestReportMessage_01(t *testing.T) {
+    request := &Envelope{Version: PROTOCOL_VERSION, Type: MSG_REPORT, ID: "3"}
+    request.Payload, _ = json.Marshal(ReportRequestPayload{`1.e4 {[%eval 0.30]} e5 {[%eval 0.35]} *`})
+    env, _ := DecodeEnvelope(ReportMessage(request))
+    assert.Equal(t, MSG_REPORT, env.Type)
+    assert.Equal(t, "3", env.ID)
+    report := GameReport{}
+    json.Unmarshal(env.Payload, &report)
+    // the first move has no evaluation before it
+    assert.Equal(t, 0, report.White.Moves)
+    assert.Equal(t, 1, report.Black.Moves)
+    assert.Equal(t, 5.0, report.Black.ACPL)
+
+    request.Payload, _ = json.Marshal(ReportRequestPayload{"1.e4 e5 *"})
+    env, _ = DecodeEnvelope(ReportMessage(request))
+    assert.Equal(t, MSG_ERROR, env.Type)
+
+    request.Payload, _ = json.Marshal(ReportRequestPayload{"1.e4 {" + strings.Repeat("x", MAX_REPORT_PGN) + "} *"})
+    env, _ = DecodeEnvelope(ReportMessage(request))
+    assert.Equal(t, MSG_ERROR, env.Type)
+    assert.Contains(t, string(env.Payload), "more than")
+}
@@ -0,0 +1,476 @@
+package main
+
+
+import (
+    "context"
+    "crypto/rand"
+    "encoding/hex"
+    "fmt"
+    "log"
+    "sync"
+    "time"
+)
+
+// Room is an analysis session that several wires share. The engines run once for the room,
+// everybody sees the same lines, only the owner steers the engines. When the owner leaves
+// the member who joined next takes over. The room ends with its last member, with a grace
+// period it waits that long for somebody to resume the session.
+type Room struct {
+    Name string // "" for a room of its own
+    ID string   // the session id to resume the room, "" if it can't be resumed
+    grace time.Duration
+    engines []*Engine
+    byName map[string]*Engine
+
+    join chan *member
+    startOnce sync.Once
+    ended chan struct{} // closed when the room stops taking members
+    done chan struct{}  // closed when the engines and all goroutines of the room have ended
+}
+
+// MEMBER_QUEUE is how many messages a member may fall behind, the oldest are dropped beyond it
+const MEMBER_QUEUE = 256
+
+// MEMBER_FLUSH is how long the last messages of an ending room may take to reach the members
+const MEMBER_FLUSH = time.Second
+
+// member is a wire in a room, left is closed when the room has let it go
+type member struct {
+    wire Wire
+    resume bool // the member comes back to the session
+    left chan struct{}
+
+    mu sync.Mutex
+    queue []queuedMessage // the messages the writer of the member hasn't sent yet
+    ready chan struct{}   // tells the writer that there are messages
+    reporting chan struct{} // holds a token while a report of the member is made
+}
+
+type queuedMessage struct {
+    engine string // the engine of an analysis update, "" for the other messages
+    msg string
+}
+
+func newMember(w Wire, resume bool) *member {
+    return &member{wire: w, resume: resume, left: make(chan struct{}), ready: make(chan struct{}, 1), reporting: make(chan struct{}, 1)}
+}
+
+// send queues a message for the member, the room never waits for a slow member.
+// A newer analysis update of an engine replaces the one that still waits.
+func (m *member) send(engine, msg string) {
+    m.mu.Lock()
+    defer m.mu.Unlock()
+    for i := len(m.queue) - 1; engine != "" && i >= 0 && m.queue[i].engine != ""; i-- {
+        if m.queue[i].engine == engine {
+            m.queue = append(m.queue[:i], m.queue[i + 1:]...)
+            break
+        }
+    }
+    m.queue = append(m.queue, queuedMessage{engine, msg})
+    if dropped := len(m.queue) - MEMBER_QUEUE; dropped > 0 {
+        log.Printf("room: a member falls behind, %d messages are dropped", dropped)
+        m.queue = m.queue[dropped:]
+    }
+    select {
+    case m.ready <- struct{}{}:
+    default:
+    }
+}
+
+// report makes a report off the room loop, the room goes on meanwhile.
+// A member gets one report at a time, a second request is answered with an error.
+func (m *member) report(wg *sync.WaitGroup, request *Envelope) {
+    select {
+    case m.reporting <- struct{}{}:
+        wg.Add(1)
+        go func() {
+            defer wg.Done()
+            m.send("", ReportMessage(request))
+            <-m.reporting
+        }()
+    default:
+        m.send("", ErrorMessage(request, fmt.Errorf("a report is still being made, ask again when it has arrived")))
+    }
+}
+
+// write passes the queued messages to the wire until the wire or ctx is done,
+// or the room has ended and nothing is left to send
+func (m *member) write(ctx context.Context, ended <-chan struct{}) {
+    for {
+        m.mu.Lock()
+        queue := m.queue
+        m.queue = nil
+        m.mu.Unlock()
+        for _, queued := range queue {
+            if !sendWire(ctx, m.wire, queued.msg) {
+                return
+            }
+        }
+        select {
+        case <-m.ready:
+        case <-ended:
+            m.mu.Lock()
+            empty := len(m.queue) == 0
+            m.mu.Unlock()
+            if empty {
+                return
+            }
+        case <-m.wire.Done():
+            return
+        case <-ctx.Done():
+            return
+        }
+    }
+}
+
+type memberInput struct {
+    member *member
+    msg string
+}
+
+// taggedOutput is a line of one of several engines
+type taggedOutput struct {
+    engine *Engine
+    output *EngineOutput
+}
+
+func NewRoom(name string, engines []*Engine) *Room {
+    byName := map[string]*Engine{}
+    for _, eng := range engines {
+        byName[eng.Name()] = eng
+    }
+    return &Room{
+        Name: name,
+        engines: engines,
+        byName: byName,
+        join: make(chan *member),
+        ended: make(chan struct{}),
+        done: make(chan struct{}),
+    }
+}
+
+// Start launches the engines, the room ends when ctx is done
+func (r *Room) Start(ctx context.Context) {
+    r.startOnce.Do(func() {
+        go r.run(ctx)
+    })
+}
+
+// Done is closed when the room and its engines have ended
+func (r *Room) Done() <-chan struct{} { return r.done }
+
+// isEnded tells whether the room stopped taking members
+func (r *Room) isEnded() bool {
+    select {
+    case <-r.ended:
+        return true
+    default:
+        return false
+    }
+}
+
+// Join adds a started wire to the room and returns when it has left and is terminated.
+// The result is false if the room had already ended, the wire is untouched then.
+func (r *Room) Join(w Wire, resume bool) bool {
+    m := newMember(w, resume)
+    select {
+    case r.join <- m:
+    case <-r.ended:
+        return false
+    }
+    <-m.left
+    w.Terminate()
+    return true
+}
+
+func (r *Room) run(ctx context.Context) {
+    // the writers of the members outlive the room a little to send its last messages
+    writeCtx, cancelWrites := context.WithCancel(ctx)
+    ctx, cancel := context.WithCancel(ctx)
+    var wg, writers sync.WaitGroup
+    members := []*member{} // the owner first
+    defer func() {
+        close(r.ended)
+        cancel()
+        for _, eng := range r.engines {
+            eng.Terminate()
+        }
+        wg.Wait()
+        written := make(chan struct{})
+        go func() {
+            writers.Wait()
+            close(written)
+        }()
+        select {
+        case <-written:
+        case <-time.After(MEMBER_FLUSH):
+        }
+        cancelWrites()
+        writers.Wait()
+        for _, m := range members {
+            close(m.left)
+        }
+        close(r.done)
+    }()
+
+    outputs := make(chan taggedOutput)
+    gaveUp := make(chan *Engine)
+    for _, eng := range r.engines {
+        eng.Start(ctx)
+        wg.Add(1)
+        go func(eng *Engine) {
+            defer wg.Done()
+            for {
+                select {
+                case output := <-eng.Output():
+                    select {
+                    case outputs <- taggedOutput{eng, output}:
+                    case <-ctx.Done():
+                        return
+                    }
+                case <-eng.Done():
+                    select {
+                    case gaveUp <- eng:
+                    case <-ctx.Done():
+                    }
+                    return
+                case <-ctx.Done():
+                    return
+                }
+            }
+        }(eng)
+    }
+
+    inputs := make(chan memberInput)
+    leaves := make(chan *member)
+    // the newest analysis of every engine, a member who joins late sees it right away
+    analysis := map[string]string{}
+    var position *Position
+    var expire <-chan time.Time // set while the room is empty and waits for a member to come back
+
+    // announce tells every member who is in the room and whether they steer it
+    announce := func() {
+        for i, m := range members {
+            m.send("", RoomMessage(r.Name, i == 0, len(members)))
+        }
+    }
+
+    running := len(r.engines)
+    for {
+        select {
+        case m := <-r.join:
+            members = append(members, m)
+            expire = nil
+            writers.Add(1)
+            go func() {
+                defer writers.Done()
+                m.write(writeCtx, r.ended)
+            }()
+            wg.Add(1)
+            go func() {
+                defer wg.Done()
+                for {
+                    select {
+                    case msg := <-m.wire.Input():
+                        select {
+                        case inputs <- memberInput{m, msg}:
+                        case <-ctx.Done():
+                            return
+                        }
+                    case <-m.wire.Done():
+                        select {
+                        case leaves <- m:
+                        case <-ctx.Done():
+                        }
+                        return
+                    case <-ctx.Done():
+                        return
+                    }
+                }
+            }()
+            if r.ID != "" {
+                m.send("", SessionMessage(r.ID, m.resume, position))
+            }
+            if r.Name != "" {
+                announce()
+            }
+            for _, eng := range r.engines {
+                if msg, ok := analysis[eng.Name()]; ok {
+                    m.send(eng.Name(), msg)
+                }
+            }
+
+        case m := <-leaves:
+            if len(members) == 1 && r.grace == 0 {
+                return // the last member is let go when the engines have quit
+            }
+            for i, other := range members {
+                if other == m {
+                    members = append(members[:i], members[i + 1:]...)
+                    break
+                }
+            }
+            close(m.left)
+            if len(members) == 0 {
+                log.Printf("session %s waits %s for a member", r.ID, r.grace)
+                expire = time.After(r.grace)
+            } else if r.Name != "" {
+                announce()
+            }
+
+        case <-expire:
+            return
+
+        case tagged := <-outputs:
+            log.Printf("[%s] %s", tagged.engine.Name(), tagged.output)
+            msg := OutputMessage(tagged.engine.Name(), tagged.output)
+            engine := ""
+            if tagged.output.PrettyLine != "" {
+                analysis[tagged.engine.Name()] = msg
+                engine = tagged.engine.Name()
+            }
+            for _, m := range members {
+                m.send(engine, msg)
+            }
+
+        case in := <-inputs:
+            log.Println(in.msg)
+            env, err := DecodeEnvelope(in.msg)
+            if err == nil && env.Type == MSG_REPORT {
+                // every member may ask for a report, the engines aren't involved
+                in.member.report(&wg, env)
+                continue
+            }
+            targets, cmds := r.engines, []string{}
+            if err == nil && in.member != members[0] {
+                err = fmt.Errorf("only the owner of room '%s' steers the engines", r.Name)
+            }
+            if err == nil {
+                targets, cmds, err = r.route(env)
+            }
+            if err != nil {
+                in.member.send("", ErrorMessage(env, err))
+                continue
+            }
+            for _, cmd := range cmds {
+                if fen, moves, ok := ParsePositionCommand(cmd); ok {
+                    position = &Position{Fen: fen, Moves: moves}
+                    analysis = map[string]string{}
+                }
+            }
+            for _, eng := range targets {
+                for _, cmd := range cmds {
+                    select {
+                    case eng.Input() <- cmd:
+                    case <-eng.Done():
+                    case <-ctx.Done():
+                        return
+                    }
+                }
+            }
+
+        case <-gaveUp:
+            // an engine that is given up has told the members why, the others keep running
+            running--
+            if running == 0 {
+                return
+            }
+        case <-ctx.Done():
+            return
+        }
+    }
+}
+
+// route finds the engines a message of the client is for and their commands
+func (r *Room) route(env *Envelope) ([]*Engine, []string, error) {
+    targets := r.engines
+    if env.Engine != "" {
+        eng, ok := r.byName[env.Engine]
+        if !ok {
+            return nil, nil, fmt.Errorf("unknown engine '%s'", env.Engine)
+        }
+        targets = []*Engine{eng}
+    }
+    cmds, err := env.Commands()
+    return targets, cmds, err
+}
+
+// SESSION_GRACE is how long a room waits for a member to come back before its engines quit
+const SESSION_GRACE = 2 * time.Minute
+
+// Rooms are the rooms of the server, the shared ones by name and all of them by session id
+type Rooms struct {
+    ctx context.Context // the rooms end with it
+    grace time.Duration
+    mu sync.Mutex
+    rooms map[string]*Room
+    sessions map[string]*Room
+    wg sync.WaitGroup
+}
+
+func NewRooms(ctx context.Context) *Rooms {
+    return &Rooms{ctx: ctx, grace: SESSION_GRACE, rooms: make(map[string]*Room), sessions: make(map[string]*Room)}
+}
+
+// Join adds a started wire to a room and returns when the wire has left and is terminated.
+// A known session id resumes that session. Otherwise the wire joins the shared room with the name,
+// without a name it gets a room of its own. A missing room is opened with the engines that newEngines returns.
+func (rs *Rooms) Join(name, id string, newEngines func() []*Engine, w Wire) {
+    for {
+        rs.mu.Lock()
+        room, resume := rs.sessions[id]
+        if !resume && name != "" {
+            room = rs.rooms[name]
+        }
+        if room == nil || room.isEnded() {
+            room = rs.open(name, newEngines())
+            resume = false
+        }
+        rs.mu.Unlock()
+        if id != "" && !resume {
+            sendWire(rs.ctx, w, ErrorMessage(nil, fmt.Errorf("session %s has expired", id)))
+        }
+        if room.Join(w, resume) {
+            return
+        }
+        id = "" // the session has just ended
+    }
+}
+
+// open starts a room, it is forgotten when it ends. The caller holds the lock.
+func (rs *Rooms) open(name string, engines []*Engine) *Room {
+    room := NewRoom(name, engines)
+    room.ID = newSessionID()
+    room.grace = rs.grace
+    rs.sessions[room.ID] = room
+    if name != "" {
+        rs.rooms[name] = room
+    }
+    room.Start(rs.ctx)
+    rs.wg.Add(1)
+    go func() {
+        defer rs.wg.Done()
+        <-room.ended
+        rs.mu.Lock()
+        delete(rs.sessions, room.ID)
+        if rs.rooms[name] == room {
+            delete(rs.rooms, name)
+        }
+        rs.mu.Unlock()
+        <-room.Done()
+    }()
+    return room
+}
+
+// Wait returns when all rooms have ended, e.g. after the context of the rooms is done
+func (rs *Rooms) Wait() {
+    rs.wg.Wait()
+}
+
+func newSessionID() string {
+    bytes := make([]byte, 16)
+    if _, err := rand.Read(bytes); err != nil {
+        panic(err)
+    }
+    return hex.EncodeToString(bytes)
+}
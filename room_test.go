@@ -0,0 +1,207 @@
+package main
+
+
+import (
+    "context"
+    "encoding/json"
+    "runtime"
+    "sync"
+    "testing"
+    "time"
+    "github.com/stretchr/testify/assert"
+)
+
+// newBufferedWire doesn't block the room while the test reads another wire
+func newBufferedWire() *fakeWire {
+    return &fakeWire{make(chan string, 100), make(chan string), make(chan struct{})}
+}
+
+func TestRooms_01(t *testing.T) {
+    before := runtime.NumGoroutine()
+    rooms := NewRooms(context.Background())
+    rooms.grace = 0
+    opened := 0
+    newEngines := func() []*Engine {
+        opened++
+        return []*Engine{NewEngine(fakeEngineConfig(t, "fake", "15"))}
+    }
+    owner, spectator := newBufferedWire(), newBufferedWire()
+    left := make(chan bool)
+    go func() {
+        rooms.Join("sunday", "", newEngines, owner)
+        left <- true
+    }()
+    messages := readUntil(t, owner, "readyok")
+    assert.Contains(t, messages[0], `"type":"session"`)
+    assert.Equal(t, `{"v":1,"type":"room","payload":{"name":"sunday","owner":true,"members":1}}`, messages[1])
+    owner.input <- `{"v":1,"type":"analyze","payload":{"depth":1}}`
+    readUntil(t, owner, "bestMove")
+
+    // the spectator sees the last analysis without running another engine
+    go func() {
+        rooms.Join("sunday", "", newEngines, spectator)
+        left <- true
+    }()
+    messages = readUntil(t, spectator, "analysisUpdate")
+    assert.Equal(t, `{"v":1,"type":"room","payload":{"name":"sunday","owner":false,"members":2}}`, messages[1])
+    assert.Contains(t, messages[2], `"score":{"cp":15}`)
+    assert.Equal(t, []string{`{"v":1,"type":"room","payload":{"name":"sunday","owner":true,"members":2}}`},
+        readUntil(t, owner, `"type":"room"`))
+    assert.Equal(t, 1, opened)
+
+    // only the owner steers the engine, everybody sees the lines
+    spectator.input <- `{"v":1,"type":"stop","id":"s1"}`
+    assert.Equal(t, []string{`{"v":1,"type":"error","id":"s1","payload":{"message":"only the owner of room 'sunday' steers the engines"}}`},
+        readUntil(t, spectator, "error"))
+    owner.input <- `{"v":1,"type":"analyze","payload":{"depth":1}}`
+    readUntil(t, owner, "bestMove")
+    readUntil(t, spectator, "bestMove")
+
+    // the spectator takes over when the owner leaves
+    close(owner.done)
+    <-left
+    assert.Equal(t, []string{`{"v":1,"type":"room","payload":{"name":"sunday","owner":true,"members":1}}`},
+        readUntil(t, spectator, `"type":"room"`))
+    spectator.input <- `{"v":1,"type":"analyze","payload":{"depth":1}}`
+    readUntil(t, spectator, "bestMove")
+
+    // the room ends with its last member
+    close(spectator.done)
+    <-left
+    waitGoroutines(t, before)
+}
+
+func TestRooms_stalled_01(t *testing.T) {
+    // a member that never reads doesn't hold up the room
+    before := runtime.NumGoroutine()
+    rooms := NewRooms(context.Background())
+    rooms.grace = 0
+    newEngines := func() []*Engine {
+        return []*Engine{NewEngine(fakeEngineConfig(t, "fake", "15"))}
+    }
+    owner, stalled := newBufferedWire(), newFakeWire()
+    left := make(chan bool)
+    go func() {
+        rooms.Join("monday", "", newEngines, owner)
+        left <- true
+    }()
+    readUntil(t, owner, "readyok")
+    go func() {
+        rooms.Join("monday", "", newEngines, stalled)
+        left <- true
+    }()
+    readUntil(t, owner, `"members":2`)
+
+    for i := 0; i < 5; i++ {
+        owner.input <- `{"v":1,"type":"analyze","payload":{"depth":1}}`
+        readUntil(t, owner, "bestMove")
+    }
+    close(stalled.done)
+    <-left
+    readUntil(t, owner, `"members":1`)
+    close(owner.done)
+    <-left
+    waitGoroutines(t, before)
+}
+
+func TestMember_send_01(t *testing.T) {
+    m := newMember(newFakeWire(), false)
+    m.send("", "room")
+    m.send("sf", "update 1")
+    m.send("lc0", "update 2")
+    m.send("sf", "update 3")
+    m.send("", "bestMove")
+    m.send("sf", "update 4")
+    assert.Equal(t, []queuedMessage{{"", "room"}, {"lc0", "update 2"}, {"sf", "update 3"}, {"", "bestMove"}, {"sf", "update 4"}}, m.queue)
+
+    // a member that falls too far behind loses the oldest messages
+    for i := 0; i < MEMBER_QUEUE - 1; i++ {
+        m.send("", "error")
+    }
+    assert.Equal(t, MEMBER_QUEUE, len(m.queue))
+    assert.Equal(t, queuedMessage{"sf", "update 4"}, m.queue[0])
+}
+
+func TestMember_report_01(t *testing.T) {
+    m := newMember(newFakeWire(), false)
+    var wg sync.WaitGroup
+    request := &Envelope{Version: PROTOCOL_VERSION, Type: MSG_REPORT, ID: "4"}
+    request.Payload, _ = json.Marshal(ReportRequestPayload{`1.e4 {[%eval 0.30]} e5 {[%eval 0.35]} *`})
+
+    // while a report is made the member gets no second one
+    m.reporting <- struct{}{}
+    m.report(&wg, request)
+    assert.Contains(t, m.queue[0].msg, "a report is still being made")
+    <-m.reporting
+
+    m.report(&wg, request)
+    wg.Wait()
+    assert.Contains(t, m.queue[1].msg, `"type":"report"`)
+    assert.Equal(t, 0, len(m.reporting))
+}
+
+// sessionOf reads the session message a wire gets first in a room
+func sessionOf(t *testing.T, w *fakeWire) SessionPayload {
+    messages := readUntil(t, w, `"type":"session"`)
+    env, err := DecodeEnvelope(messages[len(messages) - 1])
+    assert.Nil(t, err)
+    payload := SessionPayload{}
+    assert.Nil(t, json.Unmarshal(env.Payload, &payload))
+    return payload
+}
+
+func TestRooms_resume_01(t *testing.T) {
+    before := runtime.NumGoroutine()
+    rooms := NewRooms(context.Background())
+    rooms.grace = 300 * time.Millisecond
+    newEngines := func() []*Engine {
+        return []*Engine{NewEngine(fakeEngineConfig(t, "fake", "40"))}
+    }
+    join := func(id string, w *fakeWire) chan bool {
+        left := make(chan bool)
+        go func() {
+            rooms.Join("", id, newEngines, w)
+            left <- true
+        }()
+        return left
+    }
+
+    w := newBufferedWire()
+    left := join("", w)
+    session := sessionOf(t, w)
+    assert.False(t, session.Resumed)
+    readUntil(t, w, "readyok")
+    w.input <- `{"v":1,"type":"setPosition","payload":{"moves":["d2d4","d7d5"]}}`
+    w.input <- `{"v":1,"type":"analyze","payload":{"depth":1}}`
+    readUntil(t, w, "bestMove")
+
+    // the socket drops, the engine waits for the client to come back
+    close(w.done)
+    <-left
+    w = newBufferedWire()
+    left = join(session.ID, w)
+    resumed := sessionOf(t, w)
+    assert.Equal(t, SessionPayload{ID: session.ID, Resumed: true, Position: &SetPositionPayload{Moves: []string{"d2d4", "d7d5"}}}, resumed)
+    messages := readUntil(t, w, "analysisUpdate")
+    assert.Contains(t, messages[len(messages) - 1], `"score":{"cp":40}`)
+
+    // after the grace period the session is gone
+    rooms.mu.Lock()
+    room := rooms.sessions[session.ID]
+    rooms.mu.Unlock()
+    close(w.done)
+    <-left
+    select {
+    case <-room.Done():
+    case <-time.After(5 * time.Second):
+        t.Fatal("the session did not expire")
+    }
+    waitGoroutines(t, before)
+    w = newBufferedWire()
+    left = join(session.ID, w)
+    messages = readUntil(t, w, `"type":"session"`)
+    assert.Equal(t, `{"v":1,"type":"error","payload":{"message":"session ` + session.ID + ` has expired"}}`, messages[0])
+    assert.Contains(t, messages[1], `"resumed":false`)
+    close(w.done)
+    <-left
+}
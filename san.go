@@ -0,0 +1,125 @@
+package main
+
+
+import (
+    "fmt"
+    "regexp"
+    "strings"
+)
+
+// SanError tells why a move in standard algebraic notation can't be played
+type SanError struct {
+    San string
+    Kind SanErrorKind
+    Reason string
+}
+
+type SanErrorKind uint8
+
+const (
+    SAN_INVALID SanErrorKind = iota // the notation can't be read
+    SAN_ILLEGAL                     // no legal move matches
+    SAN_AMBIGUOUS                   // more than one legal move matches
+)
+
+var SAN_ERROR_KIND_TO_STRING = map[SanErrorKind]string{
+    SAN_INVALID:   "invalid move",
+    SAN_ILLEGAL:   "illegal move",
+    SAN_AMBIGUOUS: "ambiguous move",
+}
+
+func (e *SanError) Error() string {
+    return fmt.Sprintf("%s '%s': %s", SAN_ERROR_KIND_TO_STRING[e.Kind], e.San, e.Reason)
+}
+
+var FIGURINE_TO_ALGEBRAIC = strings.NewReplacer(
+    UTF8_WHITE_KING, "K", UTF8_WHITE_QUEEN, "Q", UTF8_WHITE_ROOK, "R", UTF8_WHITE_BISHOP, "B", UTF8_WHITE_KNIGHT, "N", "♙", "",
+    UTF8_BLACK_KING, "K", UTF8_BLACK_QUEEN, "Q", UTF8_BLACK_ROOK, "R", UTF8_BLACK_BISHOP, "B", UTF8_BLACK_KNIGHT, "N", "♟", "",
+)
+
+var ALGEBRAIC_TO_PIECE = map[string]PieceType{
+    "K": KING, "Q": QUEEN, "R": ROOK, "B": BISHOP, "N": KNIGHT, "": PAWN,
+}
+
+var SAN_REGEX = regexp.MustCompile(`^(?P<piece>[KQRBN])?(?P<file>[a-h])?(?P<rank>[1-8])?(?P<capture>[x:])?(?P<target>[a-h][1-8])(=?(?P<promotion>[QRBN]))?$`)
+var SAN_SUFFIX_REGEX = regexp.MustCompile(`(\s*e\.p\.)?[+#!?]*$`)
+var SAN_CASTLING_SHORT_REGEX = regexp.MustCompile(`^[O0o]-[O0o]$`)
+var SAN_CASTLING_LONG_REGEX = regexp.MustCompile(`^[O0o]-[O0o]-[O0o]$`)
+
+// ParseSAN finds the legal move in the position that is described by a move in
+// standard algebraic notation, e.g. "Nbd7", "exd6", "O-O-O", "e8=Q+", "0-0" or "♘f3".
+// The uci notation of the move is available with move.UCI().
+func (board *BitBoard) ParseSAN(san string) (*Move, error) {
+    fail := func(kind SanErrorKind, reason string, args ...interface{}) (*Move, error) {
+        return nil, &SanError{san, kind, fmt.Sprintf(reason, args...)}
+    }
+
+    text := FIGURINE_TO_ALGEBRAIC.Replace(strings.TrimSpace(san))
+    text = SAN_SUFFIX_REGEX.ReplaceAllString(text, "")
+
+    var candidates []*Move
+    if SAN_CASTLING_SHORT_REGEX.MatchString(text) || SAN_CASTLING_LONG_REGEX.MatchString(text) {
+        castlingType := CASTLING_TYPES[board.toMove][0]
+        if SAN_CASTLING_LONG_REGEX.MatchString(text) {
+            castlingType = CASTLING_TYPES[board.toMove][1]
+        }
+        for _, move := range board.LegalMoves() {
+            if move.isCastling && move.castlingType == castlingType {
+                candidates = append(candidates, move)
+            }
+        }
+    } else {
+        match := SAN_REGEX.FindStringSubmatch(text)
+        if match == nil {
+            return fail(SAN_INVALID, "not in standard algebraic notation")
+        }
+        parts := make(map[string]string)
+        for i, name := range SAN_REGEX.SubexpNames() { parts[name] = match[i] }
+
+        pieceType := ALGEBRAIC_TO_PIECE[parts["piece"]]
+        if parts["promotion"] != "" && pieceType != PAWN {
+            return fail(SAN_INVALID, "only pawns can promote")
+        }
+
+        for _, move := range board.LegalMoves() {
+            if !move.pieceType.is(pieceType) || move.isCastling { continue }
+            if move.targetSquare.name != parts["target"] { continue }
+            if parts["file"] != "" && move.initialSquare.file != parts["file"] { continue }
+            if parts["rank"] != "" && move.initialSquare.rank != parts["rank"] { continue }
+            if move.isPromotion && PIECE_TO_ALGEBRAIC[move.promotionPiece] != parts["promotion"] { continue }
+            if !move.isPromotion && parts["promotion"] != "" { continue }
+            // a capture needs something to capture, a pawn capture needs the x and the file
+            if parts["capture"] != "" && !move.isCapture { continue }
+            if pieceType == PAWN && move.isCapture && (parts["capture"] == "" || parts["file"] == "") { continue }
+            candidates = append(candidates, move)
+        }
+
+        if len(candidates) == 0 && pieceType == PAWN && parts["promotion"] == "" {
+            for _, move := range board.LegalMoves() {
+                if move.isPromotion && move.targetSquare.name == parts["target"] {
+                    return fail(SAN_INVALID, "the promotion piece is missing")
+                }
+            }
+        }
+    }
+
+    if len(candidates) == 0 {
+        return fail(SAN_ILLEGAL, "no legal move matches in %s", board.FEN())
+    } else if len(candidates) > 1 {
+        uciMoves := []string{}
+        for _, move := range candidates {
+            uciMoves = append(uciMoves, move.uciMove)
+        }
+        return fail(SAN_AMBIGUOUS, "matches %s", strings.Join(uciMoves, ", "))
+    }
+    return candidates[0], nil
+}
+
+// SanToUci converts a move in standard algebraic notation to uci notation
+func (board *BitBoard) SanToUci(san string) (string, error) {
+    move, err := board.ParseSAN(san)
+    if err != nil {
+        return "", err
+    }
+    return move.UCI(), nil
+}
@@ -0,0 +1,78 @@
+package main
+
+
+import (
+    "testing"
+    "github.com/stretchr/testify/assert"
+)
+
+func TestParseSAN_01(t *testing.T) {
+    board := NewBitBoardStart()
+    sans := map[string]string{
+        "e4": "e2e4", "e3": "e2e3", "Nf3": "g1f3", "♘c3": "b1c3", "Nh3!?": "g1h3", "b4": "b2b4",
+    }
+    for san, uciMove := range sans {
+        res, err := board.SanToUci(san)
+        assert.Nil(t, err, san)
+        assert.Equal(t, uciMove, res, san)
+    }
+}
+
+func TestParseSAN_02(t *testing.T) {
+    // disambiguation, en passant, castling and promotion
+    board := NewBitBoard(NewFen("r3k2r/1P1n1ppp/8/3pP3/8/8/8/R3K2R w KQkq d6 0 1"))
+    sans := map[string]string{
+        "exd6": "e5d6", "exd6 e.p.": "e5d6", "O-O": "e1g1", "0-0-0": "e1c1", "Kf1": "e1f1",
+        "bxa8=Q+": "b7a8q", "b8N": "b7b8n", "Rd1": "a1d1", "Rh2": "h1h2",
+    }
+    for san, uciMove := range sans {
+        res, err := board.SanToUci(san)
+        assert.Nil(t, err, san)
+        assert.Equal(t, uciMove, res, san)
+    }
+
+    board = NewBitBoard(NewFen("r3k2r/1P1n1ppp/8/3pP3/8/1n6/8/R3K1NR b KQkq - 0 1"))
+    sans = map[string]string{
+        "Nbc5": "b3c5", "Ndc5": "d7c5", "N7c5": "d7c5", "N3c5": "b3c5", "Nd7f6": "d7f6", "O-O": "e8g8", "♞f6": "d7f6",
+    }
+    for san, uciMove := range sans {
+        res, err := board.SanToUci(san)
+        assert.Nil(t, err, san)
+        assert.Equal(t, uciMove, res, san)
+    }
+}
+
+func TestParseSAN_errors_01(t *testing.T) {
+    board := NewBitBoard(NewFen("r3k2r/1P1n1ppp/8/3pP3/8/1n6/8/R3K1NR w KQkq - 0 1"))
+    errors := map[string]SanErrorKind{
+        "Nc5":   SAN_ILLEGAL,   // black knights
+        "exd6":  SAN_ILLEGAL,   // no en passant
+        "Ke3":   SAN_ILLEGAL,
+        "b8":    SAN_INVALID,   // promotion piece is missing
+        "b8=K":  SAN_INVALID,
+        "Nf3=Q": SAN_INVALID,
+        "hello": SAN_INVALID,
+        "":      SAN_INVALID,
+    }
+    for san, kind := range errors {
+        _, err := board.ParseSAN(san)
+        if assert.IsType(t, &SanError{}, err, san) {
+            assert.Equal(t, kind, err.(*SanError).Kind, san)
+        }
+    }
+
+    // the capture marker must fit the move
+    board = NewBitBoard(NewFen("r3k2r/1P1n1ppp/8/3pP3/8/8/8/R3K1NR w KQkq d6 0 1"))
+    for _, san := range []string{"Nxf3", "Kxf1", "d6", "ed6", "xd6", "bxb8=Q"} {
+        _, err := board.ParseSAN(san)
+        if assert.IsType(t, &SanError{}, err, san) {
+            assert.Equal(t, SAN_ILLEGAL, err.(*SanError).Kind, san)
+        }
+    }
+
+    board = NewBitBoard(NewFen("r3k2r/1P1n1ppp/8/3pP3/8/1n6/8/R3K1NR b KQkq - 0 1"))
+    _, err := board.ParseSAN("Nc5")
+    if assert.IsType(t, &SanError{}, err) {
+        assert.Equal(t, SAN_AMBIGUOUS, err.(*SanError).Kind)
+    }
+}
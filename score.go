@@ -0,0 +1,76 @@
+package main
+
+
+import (
+    "fmt"
+    "math"
+    "regexp"
+    "strconv"
+)
+
+// Score is an evaluation of a position. Engines report scores from the point of view
+// of the side to move, in PGN they are given from white's point of view.
+type Score struct {
+    Mate bool // Value counts the moves until mate instead of centipawns
+    Value int // positive values are good for the side the score is seen from
+    Bound ScoreBound
+}
+
+type ScoreBound uint8
+
+const (
+    EXACT ScoreBound = iota
+    LOWER_BOUND
+    UPPER_BOUND
+)
+
+// String returns the score in pawns like "0.35" or "-1.20", or the moves to mate like "#3" or "#-2"
+func (s *Score) String() string {
+    if s.Mate {
+        return fmt.Sprintf("#%d", s.Value)
+    }
+    return fmt.Sprintf("%3.2f", float64(s.Value) / 100)
+}
+
+// ForWhite turns a score seen from the side to move into a score seen from white
+func (s *Score) ForWhite(whiteToMove bool) *Score {
+    if whiteToMove {
+        return s
+    }
+    bound := s.Bound
+    if bound == LOWER_BOUND {
+        bound = UPPER_BOUND
+    } else if bound == UPPER_BOUND {
+        bound = LOWER_BOUND
+    }
+    return &Score{s.Mate, -s.Value, bound}
+}
+
+// PgnEval returns the score in the format of the %eval command used by Lichess and other GUIs,
+// e.g. "[%eval 0.35]" or "[%eval #-3]"
+func (s *Score) PgnEval() string {
+    if s.Mate {
+        return fmt.Sprintf("[%%eval #%d]", s.Value)
+    }
+    return fmt.Sprintf("[%%eval %.2f]", float64(s.Value) / 100)
+}
+
+var PGN_EVAL_REGEX = regexp.MustCompile(`\s*\[%eval\s+(#?)(-?[\d.]+)\]\s*`)
+
+// extractPgnEval removes an %eval command from a comment and returns the score that it contains
+func extractPgnEval(comment string) (string, *Score) {
+    match := PGN_EVAL_REGEX.FindStringSubmatch(comment)
+    if match == nil {
+        return comment, nil
+    }
+    value, err := strconv.ParseFloat(match[2], 64)
+    if err != nil {
+        return comment, nil
+    }
+    score := &Score{Mate: match[1] == "#", Value: int(value)}
+    if !score.Mate {
+        score.Value = int(math.Round(value * 100))
+    }
+    rest := PGN_EVAL_REGEX.ReplaceAllString(comment, " ")
+    return regexp.MustCompile(`^\s+|\s+$`).ReplaceAllString(rest, ""), score
+}
@@ -1,15 +1,22 @@
 package main
 
 import (
+    "context"
+    "sync"
+    "time"
+
     "github.com/gorilla/websocket"
 )
 
+// MAX_MESSAGE_SIZE is the largest message a client may send, a larger one ends the socket
+const MAX_MESSAGE_SIZE = 1 << 20
+
 func NewSocket(conn *websocket.Conn) *Socket {
     return &Socket{
         conn:   conn,
 		output: make(chan string),
 		input:  make(chan string),
-		err:    make(chan bool),
+		done:   make(chan struct{}),
     }
 
 }
@@ -19,42 +26,85 @@ type Socket struct {
     conn   *websocket.Conn
     output chan string
     input  chan string
-    err    chan bool
+    done   chan struct{}
+    closeOnce sync.Once
+    writerDone chan struct{} // closed when the writer has stopped, nil before Start
+    wg     sync.WaitGroup
 }
 
-func (s *Socket) Output() chan string { return s.output }
-func (s *Socket) Input() chan string { return s.input }
-func (s *Socket) Err() chan bool { return s.err }
+func (s *Socket) Output() chan<- string { return s.output }
+func (s *Socket) Input() <-chan string { return s.input }
+func (s *Socket) Done() <-chan struct{} { return s.done }
 
-func (s *Socket) Start() {
+// Start runs the reader and the writer until the connection is lost, ctx is done or Terminate is called
+func (s *Socket) Start(ctx context.Context) {
+    s.writerDone = make(chan struct{})
+    s.wg.Add(3)
     go s.writer()
     go s.reader()
+    go func() {
+        defer s.wg.Done()
+        select {
+        case <-ctx.Done():
+            s.close()
+        case <-s.done:
+        }
+    }()
 }
 
+// Terminate lets the writer finish the message it is writing, says goodbye to the browser
+// with a close message and waits for the reader and the writer
 func (s *Socket) Terminate() {
+    s.stop()
+    if s.writerDone != nil {
+        <-s.writerDone
+    }
+    goodbye := websocket.FormatCloseMessage(websocket.CloseNormalClosure, "")
+    s.conn.WriteControl(websocket.CloseMessage, goodbye, time.Now().Add(time.Second))
+    s.conn.Close()
+    s.wg.Wait()
+}
+
+func (s *Socket) stop() {
+    s.closeOnce.Do(func() { close(s.done) })
+}
+
+// close ends the socket at once, the connection is broken or the session is cancelled
+func (s *Socket) close() {
+    s.stop()
     s.conn.Close()
 }
 
 func (s *Socket) reader() {
+    defer s.wg.Done()
+    defer s.close()
+    s.conn.SetReadLimit(MAX_MESSAGE_SIZE)
     for {
         _, bytes, err := s.conn.ReadMessage()
         if err != nil {
-            s.err <- true
-            break
+            return
+        }
+        select {
+        case s.input <- string(bytes):
+        case <-s.done:
+            return
         }
-        s.input <- string(bytes)
     }
-    s.conn.Close()
 }
 
 func (s *Socket) writer() {
-    for message := range s.output {
-        bytes := []byte(message)
-        err := s.conn.WriteMessage(websocket.TextMessage, bytes)
-        if err != nil {
-            break
+    defer s.wg.Done()
+    defer close(s.writerDone)
+    for {
+        select {
+        case message := <-s.output:
+            err := s.conn.WriteMessage(websocket.TextMessage, []byte(message))
+            if err != nil {
+                s.close()
+                return
+            }
+        case <-s.done:
+            return
         }
     }
-    s.conn.Close()
 }
-
@@ -0,0 +1,142 @@
+package main
+
+
+type GameStatus uint8
+
+const (
+    ONGOING GameStatus = iota
+    CHECKMATE
+    STALEMATE
+    INSUFFICIENT_MATERIAL
+    SEVENTYFIVE_MOVE_RULE
+    FIVEFOLD_REPETITION
+    THREEFOLD_REPETITION
+    FIFTY_MOVE_RULE
+)
+
+var GAME_STATUS_TO_STRING = map[GameStatus]string{
+    ONGOING:               "ongoing",
+    CHECKMATE:             "checkmate",
+    STALEMATE:             "stalemate",
+    INSUFFICIENT_MATERIAL: "insufficient material",
+    SEVENTYFIVE_MOVE_RULE: "seventy-five move rule",
+    FIVEFOLD_REPETITION:   "fivefold repetition",
+    THREEFOLD_REPETITION:  "threefold repetition",
+    FIFTY_MOVE_RULE:       "fifty move rule",
+}
+
+func (s GameStatus) String() string {
+    return GAME_STATUS_TO_STRING[s]
+}
+
+const RESULT_WHITE_WINS = "1-0"
+const RESULT_BLACK_WINS = "0-1"
+const RESULT_DRAW = "1/2-1/2"
+const RESULT_UNKNOWN = "*"
+
+const LIGHT_SQUARES = 0x55AA55AA55AA55AA
+const DARK_SQUARES = ^uint64(LIGHT_SQUARES)
+
+// Status tells if the game has ended in the current position. Only the endings that
+// need no claim count, see ClaimableDraw for threefold repetition and the fifty move rule.
+// Repetitions are only found among the positions reached with Make.
+func (board *BitBoard) Status() GameStatus {
+    if len(board.LegalMoves()) == 0 {
+        if board.isCheck(!board.toMove) {
+            return CHECKMATE
+        }
+        return STALEMATE
+    }
+    if board.isInsufficientMaterial() {
+        return INSUFFICIENT_MATERIAL
+    }
+    if board.halfmoveClock >= 150 {
+        return SEVENTYFIVE_MOVE_RULE
+    }
+    if board.repetitions() >= 5 {
+        return FIVEFOLD_REPETITION
+    }
+    return ONGOING
+}
+
+// ClaimableDraw tells whether a player may claim a draw by threefold repetition
+// or the fifty move rule, ONGOING if there is nothing to claim. The game goes on without a claim.
+func (board *BitBoard) ClaimableDraw() GameStatus {
+    if board.repetitions() >= 3 {
+        return THREEFOLD_REPETITION
+    }
+    if board.halfmoveClock >= 100 {
+        return FIFTY_MOVE_RULE
+    }
+    return ONGOING
+}
+
+// CanClaimDraw is true if a player may claim a draw
+func (board *BitBoard) CanClaimDraw() bool {
+    return board.ClaimableDraw() != ONGOING
+}
+
+// Result returns the result of the game in PGN notation, "*" if the game goes on
+func (board *BitBoard) Result() string {
+    switch board.Status() {
+    case ONGOING:
+        return RESULT_UNKNOWN
+    case CHECKMATE:
+        if board.toMove == WHITE {
+            return RESULT_BLACK_WINS
+        }
+        return RESULT_WHITE_WINS
+    default:
+        return RESULT_DRAW
+    }
+}
+
+// isInsufficientMaterial is true if no sequence of legal moves leads to a checkmate:
+// king against king with at most one minor piece, or only bishops on squares of the same color
+func (board *BitBoard) isInsufficientMaterial() bool {
+    heavy := board.get([]PieceType{WHITE_QUEEN, WHITE_ROOK, WHITE_PAWN, BLACK_QUEEN, BLACK_ROOK, BLACK_PAWN})
+    if heavy != 0 {
+        return false
+    }
+    knights := board.get([]PieceType{WHITE_KNIGHT, BLACK_KNIGHT})
+    bishops := board.get([]PieceType{WHITE_BISHOP, BLACK_BISHOP})
+
+    if len(findBitPositions(knights | bishops)) <= 1 {
+        return true
+    }
+    return knights == 0 && (bishops & LIGHT_SQUARES == 0 || bishops & DARK_SQUARES == 0)
+}
+
+// positionKey identifies a position for the repetition rules
+type positionKey struct {
+    layers [PIECE_TYPE_COUNT]uint64
+    toMove Color
+    castlingRights CastlingRights
+    enPassant uint64
+}
+
+func (board *BitBoard) key() positionKey {
+    // the en passant square only matters if a pawn can capture there
+    enPassant := board.enPassant
+    pawnType := BLACK_PAWN
+    if board.toMove == WHITE {
+        pawnType = WHITE_PAWN
+    }
+    if enPassant != 0 && pawnMask(NewSquareByNum(findBitPositions(enPassant)[0]), !board.toMove) & board.layers[pawnType] == 0 {
+        enPassant = 0
+    }
+    return positionKey{board.layers, board.toMove, board.castlingRights, enPassant}
+}
+
+// repetitions counts how often the current position occurred, including this time
+func (board *BitBoard) repetitions() int {
+    key := board.key()
+    count := 1
+    // positions before the last capture or pawn move can't repeat
+    for i := len(board.history) - 1; i >= 0 && i >= len(board.history) - board.halfmoveClock; i-- {
+        if board.history[i].key() == key {
+            count++
+        }
+    }
+    return count
+}
@@ -0,0 +1,79 @@
+package main
+
+
+import (
+    "testing"
+    "github.com/stretchr/testify/assert"
+)
+
+func TestStatus_01(t *testing.T) {
+    positions := map[string]GameStatus{
+        STARTPOSITION: ONGOING,
+        "rnb1kbnr/pppp1ppp/8/4p3/6Pq/5P2/PPPPP2P/RNBQKBNR w KQkq - 1 3": CHECKMATE,
+        "7k/8/6QK/8/8/8/8/8 b - - 0 1":     STALEMATE,
+        "8/8/4k3/8/8/3K4/8/8 w - - 0 1":    INSUFFICIENT_MATERIAL,
+        "8/8/4k3/8/8/3K1N2/8/8 w - - 0 1":  INSUFFICIENT_MATERIAL,
+        "8/8/4k3/8/8/3K1B2/8/8 w - - 0 1":  INSUFFICIENT_MATERIAL,
+        "8/5b2/4k3/8/8/3K1B2/8/8 w - - 0 1": INSUFFICIENT_MATERIAL, // bishops on light squares
+        "8/6b1/4k3/8/8/3K1B2/8/8 w - - 0 1": ONGOING,               // bishops of opposite color
+        "8/8/4k3/8/8/3KNN2/8/8 w - - 0 1":  ONGOING,
+        "8/8/4k3/8/8/3K4/7P/8 w - - 0 1":   ONGOING,
+        "8/8/4k3/8/8/3K4/7R/8 w - - 99 80": ONGOING,
+        "8/8/4k3/8/8/3K4/7R/8 w - - 100 80": ONGOING, // the fifty move rule needs a claim
+        "8/8/4k3/8/8/3K4/7R/8 w - - 150 80": SEVENTYFIVE_MOVE_RULE,
+    }
+    for fenString, status := range positions {
+        board := NewBitBoard(NewFen(fenString))
+        assert.Equal(t, status, board.Status(), fenString)
+    }
+}
+
+func TestStatus_threefold_01(t *testing.T) {
+    board := NewBitBoardStart()
+    for _, uciMove := range []string{"g1f3", "g8f6", "f3g1", "f6g8", "g1f3", "g8f6", "f3g1"} {
+        board.Make(NewMove(uciMove, board))
+        assert.Equal(t, ONGOING, board.Status())
+    }
+    board.Make(NewMove("f6g8", board))
+    // a player may claim the draw, the game has not ended yet
+    assert.Equal(t, ONGOING, board.Status())
+    assert.Equal(t, THREEFOLD_REPETITION, board.ClaimableDraw())
+    assert.Equal(t, RESULT_UNKNOWN, board.Result())
+
+    board.Unmake()
+    assert.False(t, board.CanClaimDraw())
+
+    for _, uciMove := range []string{"f6g8", "g1f3", "g8f6", "f3g1", "f6g8", "g1f3", "g8f6", "f3g1"} {
+        board.Make(NewMove(uciMove, board))
+    }
+    assert.Equal(t, ONGOING, board.Status())
+    board.Make(NewMove("f6g8", board))
+    assert.Equal(t, FIVEFOLD_REPETITION, board.Status())
+    assert.Equal(t, RESULT_DRAW, board.Result())
+}
+
+func TestClaimableDraw_01(t *testing.T) {
+    board := NewBitBoard(NewFen("8/8/4k3/8/8/3K4/7R/8 w - - 99 80"))
+    assert.False(t, board.CanClaimDraw())
+    board = NewBitBoard(NewFen("8/8/4k3/8/8/3K4/7R/8 w - - 100 80"))
+    assert.Equal(t, FIFTY_MOVE_RULE, board.ClaimableDraw())
+}
+
+func TestStatus_threefold_02(t *testing.T) {
+    // the position after 2...e5 differs from the repeated ones by the lost castling rights
+    board := NewBitBoardStart()
+    for _, uciMove := range []string{"e2e4", "e7e5", "e1e2", "e8e7", "e2e1", "e7e8", "e1e2", "e8e7", "e2e1", "e7e8"} {
+        board.Make(NewMove(uciMove, board))
+    }
+    assert.Equal(t, 2, board.repetitions())
+    assert.Equal(t, ONGOING, board.Status())
+}
+
+func TestResult_01(t *testing.T) {
+    board := NewBitBoard(NewFen("rnb1kbnr/pppp1ppp/8/4p3/6Pq/5P2/PPPPP2P/RNBQKBNR w KQkq - 1 3"))
+    assert.Equal(t, RESULT_BLACK_WINS, board.Result())
+    board = NewBitBoard(NewFen("6k1/5ppp/8/8/8/8/8/3R2K1 w - - 0 1"))
+    assert.Equal(t, RESULT_UNKNOWN, board.Result())
+    board.Make(NewMove("d1d8", board))
+    assert.Equal(t, RESULT_WHITE_WINS, board.Result())
+}
@@ -0,0 +1,150 @@
+package main
+
+
+import (
+    "context"
+    "fmt"
+    "log"
+    "time"
+)
+
+// RestartPolicy tells how often and how fast a crashed engine is restarted
+type RestartPolicy struct {
+    MaxRestarts int // consecutive failures until the engine is given up
+    MinBackoff time.Duration // the wait before the first restart, it doubles with every failure
+    MaxBackoff time.Duration
+    StableAfter time.Duration // an engine running this long has its failures forgiven
+}
+
+var DEFAULT_RESTART_POLICY = RestartPolicy{
+    MaxRestarts: 5,
+    MinBackoff: 500 * time.Millisecond,
+    MaxBackoff: 30 * time.Second,
+    StableAfter: time.Minute,
+}
+
+// backoff is the wait before a restart after the given number of consecutive failures
+func (p RestartPolicy) backoff(failures int) time.Duration {
+    delay := p.MinBackoff
+    for i := 1; i < failures && delay < p.MaxBackoff; i++ {
+        delay *= 2
+    }
+    if delay > p.MaxBackoff {
+        delay = p.MaxBackoff
+    }
+    return delay
+}
+
+const (
+    ENGINE_LAUNCH_FAILED = "launch failed"
+    ENGINE_CRASHED = "crashed"
+)
+
+// EngineError reports an engine that could not be started or has crashed
+type EngineError struct {
+    Engine string
+    Kind string // ENGINE_LAUNCH_FAILED or ENGINE_CRASHED
+    Reason string // the launch error or the exit status
+    Stderr string // the last lines the engine wrote to stderr
+    Restart int // the number of the following restart, 0 when the engine is given up
+    RestartIn time.Duration
+}
+
+func (e *EngineError) Error() string {
+    msg := fmt.Sprintf("engine %s %s: %s", e.Engine, e.Kind, e.Reason)
+    if e.Stderr != "" {
+        msg += fmt.Sprintf(" (stderr: %s)", e.Stderr)
+    }
+    if e.Restart == 0 {
+        return msg + ", giving up"
+    }
+    return msg + fmt.Sprintf(", restart %d in %s", e.Restart, e.RestartIn)
+}
+
+// supervise runs the engine process and restarts it until the engine is terminated
+// or it fails too often. The user is told about every failure.
+func (eng *Engine) supervise() {
+    as := NewAnalysisState(STARTPOSITION)
+    failures := 0
+    for {
+        started := time.Now()
+        engineErr := eng.run(as, failures > 0)
+        if engineErr == nil {
+            return
+        }
+        if time.Since(started) > eng.restart.StableAfter {
+            failures = 0
+        }
+        failures++
+        if failures <= eng.restart.MaxRestarts {
+            engineErr.Restart = failures
+            engineErr.RestartIn = eng.restart.backoff(failures)
+        }
+        log.Println(engineErr)
+        eng.send(&EngineOutput{Raw: "error " + engineErr.Error(), Error: engineErr})
+
+        if engineErr.Restart == 0 {
+            return
+        }
+        select {
+        case <-time.After(engineErr.RestartIn):
+        case <-eng.terminated:
+            return
+        }
+    }
+}
+
+// run launches the engine process and talks to it until it ends.
+// The result is nil when the engine was terminated, otherwise it tells what went wrong.
+func (eng *Engine) run(as *AnalysisState, replay bool) *EngineError {
+    process, err := NewProcessEndpoint(eng.config)
+    if err != nil {
+        return &EngineError{Engine: eng.Name(), Kind: ENGINE_LAUNCH_FAILED, Reason: err.Error()}
+    }
+    client := NewUciClient(process.Input(), process.Output())
+    client.Lines = make(chan string)
+    client.Stopped = eng.terminated
+    // Terminate stops the process, nobody takes the commands and the lines anymore
+    ctx, cancel := context.WithCancel(context.Background())
+    defer cancel()
+    go func() {
+        select {
+        case <-eng.terminated:
+            cancel()
+        case <-ctx.Done():
+        }
+    }()
+
+    eng.mu.Lock()
+    eng.process, eng.client = process, client
+    eng.mu.Unlock()
+    select {
+    case <-eng.terminated:
+        // Terminate was called before the process was known
+        process.Terminate()
+        return nil
+    default:
+    }
+
+    process.Start()
+    client.Start(ctx)
+    talk(ctx, eng, process, client, as, replay)
+    cancel()
+    process.Terminate()
+    <-client.Closed()
+
+    eng.mu.Lock()
+    eng.client = nil
+    eng.mu.Unlock()
+    select {
+    case <-eng.terminated:
+        return nil
+    default:
+    }
+    return &EngineError{
+        Engine: eng.Name(),
+        Kind: ENGINE_CRASHED,
+        Reason: process.ExitReason(),
+        Stderr: process.Stderr(),
+    }
+}
@@ -0,0 +1,96 @@
+package main
+
+
+import (
+    "context"
+    "strings"
+    "testing"
+    "time"
+    "github.com/stretchr/testify/assert"
+)
+
+// readEngineUntil collects the output of the engine until a line contains text
+func readEngineUntil(t *testing.T, eng *Engine, text string) []*EngineOutput {
+    outputs := []*EngineOutput{}
+    timeout := time.After(5 * time.Second)
+    for {
+        select {
+        case output := <-eng.Output():
+            outputs = append(outputs, output)
+            if strings.Contains(output.String(), text) {
+                return outputs
+            }
+        case <-timeout:
+            t.Fatalf("'%s' not received from %s", text, eng.Name())
+        }
+    }
+}
+
+var TEST_RESTART_POLICY = RestartPolicy{MaxRestarts: 2, MinBackoff: time.Millisecond, MaxBackoff: 5 * time.Millisecond, StableAfter: time.Minute}
+
+func TestRestartPolicy_backoff_01(t *testing.T) {
+    policy := DEFAULT_RESTART_POLICY
+    assert.Equal(t, 500 * time.Millisecond, policy.backoff(1))
+    assert.Equal(t, time.Second, policy.backoff(2))
+    assert.Equal(t, 4 * time.Second, policy.backoff(4))
+    assert.Equal(t, 30 * time.Second, policy.backoff(10))
+}
+
+func TestSupervisor_launch_01(t *testing.T) {
+    eng := NewEngine(&EngineConfig{Name: "missing", Path: "/does/not/exist/engine"})
+    eng.restart = TEST_RESTART_POLICY
+    eng.Start(context.Background())
+    defer eng.Terminate()
+
+    for _, restart := range []int{1, 2, 0} {
+        output := <-eng.Output()
+        assert.Equal(t, ENGINE_LAUNCH_FAILED, output.Error.Kind)
+        assert.Equal(t, restart, output.Error.Restart)
+        assert.True(t, strings.HasPrefix(output.String(), "error engine missing launch failed: "), output.String())
+    }
+    select {
+    case <-eng.Done():
+    case <-time.After(5 * time.Second):
+        t.Fatal("the engine was not given up")
+    }
+}
+
+func TestSupervisor_crash_01(t *testing.T) {
+    eng := NewEngine(fakeEngineConfig(t, "fake", "10"))
+    eng.restart = TEST_RESTART_POLICY
+    eng.Start(context.Background())
+    defer eng.Terminate()
+    readEngineUntil(t, eng, "readyok")
+
+    eng.Input() <- "position startpos moves e2e4"
+    readEngineUntil(t, eng, "info string position startpos moves e2e4")
+    eng.Input() <- "crash"
+
+    outputs := readEngineUntil(t, eng, "error")
+    engineErr := outputs[len(outputs) - 1].Error
+    assert.Equal(t, ENGINE_CRASHED, engineErr.Kind)
+    assert.Equal(t, "signal: segmentation fault", engineErr.Reason)
+    assert.Equal(t, "boom", engineErr.Stderr)
+    assert.Equal(t, 1, engineErr.Restart)
+
+    // the restarted engine gets the position again
+    readEngineUntil(t, eng, "readyok")
+    readEngineUntil(t, eng, "info string position startpos moves e2e4")
+    eng.Input() <- "go depth 1"
+    readEngineUntil(t, eng, "bestmove e2e4")
+}
+
+func TestAnalysisState_replayCommands_01(t *testing.T) {
+    as := NewAnalysisState(STARTPOSITION)
+    as.CmdUpdate("setoption name MultiPV value 3")
+    as.CmdUpdate("position startpos moves e2e4")
+    as.CmdUpdate("setoption name multipv value 2")
+    as.CmdUpdate("setoption name Hash value 64")
+    assert.Equal(t, []string{"setoption name Hash value 64", "setoption name multipv value 2", "position startpos moves e2e4"}, as.replayCommands())
+    as.CmdUpdate("go infinite")
+    assert.Equal(t, "go infinite", as.replayCommands()[3])
+
+    // the multipv of an analysis takes the place of the option
+    as.CmdUpdate("multipv 4")
+    assert.Equal(t, []string{"multipv 4", "setoption name Hash value 64"}, as.replayCommands()[:2])
+}
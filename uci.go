@@ -0,0 +1,458 @@
+package main
+
+
+import (
+    "context"
+    "errors"
+    "fmt"
+    "log"
+    "strings"
+    "sync"
+    "time"
+)
+
+// UciState is the state of the conversation with a uci engine
+type UciState int
+
+const (
+    UCI_STARTED UciState = iota // the process runs, "uci" was not sent yet
+    UCI_HANDSHAKE               // "uci" was sent, waiting for "uciok"
+    UCI_READY                   // idle, a search can be started
+    UCI_SEARCHING               // "go" was sent, waiting for "bestmove"
+    UCI_STOPPING                // "stop" was sent, waiting for "bestmove"
+    UCI_CLOSED                  // the engine output has ended
+)
+
+var UCI_STATE_NAMES = map[UciState]string{
+    UCI_STARTED: "started", UCI_HANDSHAKE: "handshake", UCI_READY: "ready",
+    UCI_SEARCHING: "searching", UCI_STOPPING: "stopping", UCI_CLOSED: "closed",
+}
+
+func (s UciState) String() string {
+    return UCI_STATE_NAMES[s]
+}
+
+var ErrEngineClosed = errors.New("uci: the engine has closed its output")
+
+// Position is the position a search starts from, given as uci commands
+type Position struct {
+    Fen string // "" for the start position
+    Moves []string // uci moves played from the position
+}
+
+// Command returns the "position" command, e.g. "position startpos moves e2e4 e7e5"
+func (p Position) Command() string {
+    cmd := "position startpos"
+    if p.Fen != "" {
+        cmd = "position fen " + p.Fen
+    }
+    if len(p.Moves) > 0 {
+        cmd += " moves " + strings.Join(p.Moves, " ")
+    }
+    return cmd
+}
+
+// Board plays the moves from the position, the fen and every move must be valid
+func (p Position) Board() (*BitBoard, error) {
+    return positionBoard(p.Fen, p.Moves)
+}
+
+// Limits restrict a search. A search without limits runs until it is stopped.
+type Limits struct {
+    Depth int
+    Nodes int64
+    Mate int
+    MoveTime time.Duration
+    WTime, BTime time.Duration
+    WInc, BInc time.Duration
+    MovesToGo int
+    SearchMoves []string
+    Ponder bool
+    Infinite bool
+}
+
+// Command returns the "go" command for the limits
+func (l Limits) Command() string {
+    parts := []string{"go"}
+    if l.Ponder {
+        parts = append(parts, "ponder")
+    }
+    if len(l.SearchMoves) > 0 {
+        parts = append(parts, "searchmoves")
+        parts = append(parts, l.SearchMoves...)
+    }
+    add := func(name string, value int64) {
+        if value > 0 {
+            parts = append(parts, fmt.Sprintf("%s %d", name, value))
+        }
+    }
+    add("wtime", l.WTime.Milliseconds())
+    add("btime", l.BTime.Milliseconds())
+    add("winc", l.WInc.Milliseconds())
+    add("binc", l.BInc.Milliseconds())
+    add("movestogo", int64(l.MovesToGo))
+    add("depth", int64(l.Depth))
+    add("nodes", l.Nodes)
+    add("mate", int64(l.Mate))
+    add("movetime", l.MoveTime.Milliseconds())
+    if l.Infinite || len(parts) == 1 || (len(parts) == 2 && l.Ponder) {
+        parts = append(parts, "infinite")
+    }
+    return strings.Join(parts, " ")
+}
+
+// BestMove is the result of a search
+type BestMove struct {
+    Move string // "(none)" or "0000" when there is no legal move
+    Ponder string // "" if the engine did not send a move to ponder on
+}
+
+func parseBestMove(line string) *BestMove {
+    fields := strings.Fields(line)
+    bestMove := &BestMove{}
+    if len(fields) > 1 {
+        bestMove.Move = fields[1]
+    }
+    if len(fields) > 3 && fields[2] == "ponder" {
+        bestMove.Ponder = fields[3]
+    }
+    return bestMove
+}
+
+// UciClient talks the uci protocol with an engine. The engine is reached through two channels,
+// commands are written to input and the lines of the engine are read from output.
+type UciClient struct {
+    input chan<- string
+    output <-chan string
+    Lines chan string // every line of the engine is forwarded here, when it is set before Start
+    Stopped <-chan struct{} // closed when the process is terminated, the commands and lines give up then
+
+    mu sync.Mutex
+    state UciState
+    Name string
+    Author string
+    Options []*UciOption // the options announced in the handshake
+    waiting map[string][]chan struct{} // the requests waiting for "uciok" or "readyok"
+    search *Search
+    closed chan struct{}
+}
+
+func NewUciClient(input chan<- string, output <-chan string) *UciClient {
+    return &UciClient{
+        input: input,
+        output: output,
+        waiting: make(map[string][]chan struct{}),
+        closed: make(chan struct{}),
+    }
+}
+
+// Start reads the engine output until it ends. When ctx is done the lines are not forwarded anymore.
+func (c *UciClient) Start(ctx context.Context) {
+    go c.read(ctx)
+}
+
+func (c *UciClient) State() UciState {
+    c.mu.Lock()
+    defer c.mu.Unlock()
+    return c.state
+}
+
+// Closed is closed when the engine output has ended
+func (c *UciClient) Closed() <-chan struct{} { return c.closed }
+
+// Handshake sends "uci" and waits until the engine has told its name and options
+func (c *UciClient) Handshake(ctx context.Context) error {
+    return c.request(ctx, "uci", "uciok")
+}
+
+// IsReady waits until the engine has processed all commands sent before
+func (c *UciClient) IsReady(ctx context.Context) error {
+    return c.request(ctx, "isready", "readyok")
+}
+
+// NewGame tells the engine that the next search is from a different game
+func (c *UciClient) NewGame(ctx context.Context) error {
+    if err := c.send(ctx, "ucinewgame"); err != nil {
+        return err
+    }
+    return c.IsReady(ctx)
+}
+
+// OptionList returns the options announced by the engine
+func (c *UciClient) OptionList() []*UciOption {
+    c.mu.Lock()
+    defer c.mu.Unlock()
+    return append([]*UciOption{}, c.Options...)
+}
+
+// Option finds an option by its name, the case of the name doesn't matter
+func (c *UciClient) Option(name string) *UciOption {
+    c.mu.Lock()
+    defer c.mu.Unlock()
+    for _, option := range c.Options {
+        if strings.EqualFold(option.Name, name) {
+            return option
+        }
+    }
+    return nil
+}
+
+// SetOption sends a "setoption" command, the value is left out for buttons.
+// When the engine has announced its options the value is validated first.
+func (c *UciClient) SetOption(ctx context.Context, name, value string) error {
+    option := c.Option(name)
+    c.mu.Lock()
+    announced := len(c.Options) > 0
+    c.mu.Unlock()
+    if option != nil {
+        if err := option.Validate(value); err != nil {
+            return err
+        }
+        name = option.Name
+    } else if announced {
+        return &OptionError{name, value, "is given for an unknown option"}
+    }
+    cmd := "setoption name " + name
+    if value != "" {
+        cmd += " value " + value
+    }
+    return c.send(ctx, cmd)
+}
+
+// Send passes a command typed by a user to the engine and keeps track of the state it leads to
+func (c *UciClient) Send(ctx context.Context, cmd string) error {
+    fields := strings.Fields(cmd)
+    if len(fields) == 0 {
+        return nil
+    }
+    c.mu.Lock()
+    switch fields[0] {
+    case "uci":
+        c.state = UCI_HANDSHAKE
+    case "go":
+        if c.state == UCI_READY || c.state == UCI_STARTED {
+            c.state = UCI_SEARCHING
+        }
+    case "stop":
+        if c.state == UCI_SEARCHING {
+            c.state = UCI_STOPPING
+        }
+    }
+    c.mu.Unlock()
+    return c.send(ctx, cmd)
+}
+
+// Analyze sets up the position and starts a search. The search is stopped when the context is done.
+// The info lines of the search must be read from Search.Info until it is closed.
+func (c *UciClient) Analyze(ctx context.Context, position Position, limits Limits) (*Search, error) {
+    if state := c.State(); state != UCI_READY {
+        return nil, fmt.Errorf("uci: can't start a search, the engine is %s", state)
+    }
+    if err := c.send(ctx, position.Command()); err != nil {
+        return nil, err
+    }
+    if err := c.IsReady(ctx); err != nil {
+        return nil, err
+    }
+
+    search := &Search{
+        Info: make(chan *InfoLine),
+        client: c,
+        ctx: ctx,
+        done: make(chan struct{}),
+    }
+    c.mu.Lock()
+    if c.state != UCI_READY {
+        state := c.state
+        c.mu.Unlock()
+        return nil, fmt.Errorf("uci: can't start a search, the engine is %s", state)
+    }
+    c.state = UCI_SEARCHING
+    c.search = search
+    c.mu.Unlock()
+
+    if err := c.send(ctx, limits.Command()); err != nil {
+        c.mu.Lock()
+        c.state = UCI_READY
+        c.search = nil
+        c.mu.Unlock()
+        return nil, err
+    }
+    go func() {
+        select {
+        case <-ctx.Done():
+            search.Stop()
+        case <-search.done:
+        }
+    }()
+    return search, nil
+}
+
+// send writes a command to the engine
+func (c *UciClient) send(ctx context.Context, cmd string) error {
+    select {
+    case c.input <- cmd:
+        return nil
+    case <-ctx.Done():
+        return ctx.Err()
+    case <-c.closed:
+        return ErrEngineClosed
+    case <-c.Stopped:
+        return ErrEngineClosed
+    }
+}
+
+// request sends a command and waits for the reply
+func (c *UciClient) request(ctx context.Context, cmd, reply string) error {
+    received := make(chan struct{})
+    c.mu.Lock()
+    c.waiting[reply] = append(c.waiting[reply], received)
+    if cmd == "uci" {
+        c.state = UCI_HANDSHAKE
+    }
+    c.mu.Unlock()
+
+    if err := c.send(ctx, cmd); err != nil {
+        return err
+    }
+    select {
+    case <-received:
+        return nil
+    case <-ctx.Done():
+        return ctx.Err()
+    case <-c.closed:
+        return ErrEngineClosed
+    }
+}
+
+func (c *UciClient) read(ctx context.Context) {
+    for line := range c.output {
+        c.handle(line)
+        if c.Lines != nil {
+            select {
+            case c.Lines <- line:
+            case <-ctx.Done():
+            case <-c.Stopped:
+            }
+        }
+    }
+
+    c.mu.Lock()
+    c.state = UCI_CLOSED
+    search := c.search
+    c.search = nil
+    c.mu.Unlock()
+    close(c.closed)
+    if search != nil {
+        search.finish(nil, ErrEngineClosed)
+    }
+    if c.Lines != nil {
+        close(c.Lines)
+    }
+}
+
+// handle changes the state for a line of the engine
+func (c *UciClient) handle(line string) {
+    fields := strings.Fields(line)
+    if len(fields) == 0 {
+        return
+    }
+
+    c.mu.Lock()
+    search := c.search
+    switch fields[0] {
+    case "id":
+        if len(fields) > 2 && fields[1] == "name" {
+            c.Name = strings.Join(fields[2:], " ")
+        } else if len(fields) > 2 && fields[1] == "author" {
+            c.Author = strings.Join(fields[2:], " ")
+        }
+    case "option":
+        option, err := ParseUciOption(line)
+        if err != nil {
+            log.Println(err)
+            break
+        }
+        c.Options = append(c.Options, option)
+    case "uciok", "readyok":
+        if fields[0] == "uciok" && c.state == UCI_HANDSHAKE {
+            c.state = UCI_READY
+        }
+        for _, received := range c.waiting[fields[0]] {
+            close(received)
+        }
+        delete(c.waiting, fields[0])
+    case "bestmove":
+        c.state = UCI_READY
+        c.search = nil
+    }
+    c.mu.Unlock()
+
+    if search == nil {
+        return
+    }
+    switch fields[0] {
+    case "info":
+        if info, err := ParseInfoLine(line); err == nil {
+            search.send(info)
+        }
+    case "bestmove":
+        search.finish(parseBestMove(line), nil)
+    }
+}
+
+// Search is a running search started by Analyze
+type Search struct {
+    Info chan *InfoLine // closed when the search has ended
+    client *UciClient
+    ctx context.Context
+    stopOnce sync.Once
+    done chan struct{}
+    bestMove *BestMove
+    err error
+}
+
+// Stop ends the search, the engine still sends its best move
+func (s *Search) Stop() {
+    s.stopOnce.Do(func() {
+        c := s.client
+        c.mu.Lock()
+        searching := c.state == UCI_SEARCHING && c.search == s
+        if searching {
+            c.state = UCI_STOPPING
+        }
+        c.mu.Unlock()
+        if searching {
+            c.send(context.Background(), "stop")
+        }
+    })
+}
+
+// PonderHit tells the engine that the opponent has played the expected move
+func (s *Search) PonderHit() error {
+    return s.client.send(s.ctx, "ponderhit")
+}
+
+// Done is closed when the search has ended
+func (s *Search) Done() <-chan struct{} { return s.done }
+
+// Wait blocks until the engine has sent its best move
+func (s *Search) Wait() (*BestMove, error) {
+    <-s.done
+    return s.bestMove, s.err
+}
+
+// send passes an info line to the reader of the search, it is dropped when the search was cancelled
+func (s *Search) send(info *InfoLine) {
+    select {
+    case s.Info <- info:
+    case <-s.ctx.Done():
+    }
+}
+
+func (s *Search) finish(bestMove *BestMove, err error) {
+    s.bestMove = bestMove
+    s.err = err
+    close(s.Info)
+    close(s.done)
+}
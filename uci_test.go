@@ -0,0 +1,126 @@
+package main
+
+
+import (
+    "context"
+    "strings"
+    "testing"
+    "time"
+    "github.com/stretchr/testify/assert"
+)
+
+// fakeEngine answers uci commands like a very fast engine, "quit" closes its output
+func fakeEngine(input <-chan string, output chan<- string) {
+    searching := false
+    for cmd := range input {
+        fields := strings.Fields(cmd)
+        switch fields[0] {
+        case "uci":
+            output <- "id name Fakefish 1"
+            output <- "id author The Harpa team"
+            output <- "option name Hash type spin default 16 min 1 max 1024"
+            output <- "uciok"
+        case "isready":
+            output <- "readyok"
+        case "go":
+            output <- "info depth 1 score cp 20 pv e2e4"
+            output <- "info depth 2 score cp 15 pv e2e4 e7e5"
+            if strings.Contains(cmd, "infinite") {
+                searching = true
+            } else {
+                output <- "bestmove e2e4 ponder e7e5"
+            }
+        case "stop":
+            if searching {
+                output <- "bestmove d2d4"
+                searching = false
+            }
+        case "quit":
+            close(output)
+            return
+        }
+    }
+}
+
+func newFakeClient(t *testing.T) (*UciClient, chan string) {
+    input, output := make(chan string), make(chan string)
+    go fakeEngine(input, output)
+    client := NewUciClient(input, output)
+    client.Start(context.Background())
+    assert.Equal(t, UCI_STARTED, client.State())
+    assert.Nil(t, client.Handshake(context.Background()))
+    return client, input
+}
+
+func TestUciClient_handshake_01(t *testing.T) {
+    client, _ := newFakeClient(t)
+    assert.Equal(t, UCI_READY, client.State())
+    assert.Equal(t, "Fakefish 1", client.Name)
+    assert.Equal(t, "The Harpa team", client.Author)
+    assert.Equal(t, []*UciOption{{Name: "Hash", Type: OPTION_SPIN, Default: "16", Min: 1, Max: 1024}}, client.Options)
+    assert.Nil(t, client.NewGame(context.Background()))
+}
+
+func TestUciClient_analyze_01(t *testing.T) {
+    client, _ := newFakeClient(t)
+    search, err := client.Analyze(context.Background(), Position{Moves: []string{"e2e4"}}, Limits{Depth: 2})
+    assert.Nil(t, err)
+
+    depths := []int{}
+    for info := range search.Info {
+        depths = append(depths, info.Depth)
+    }
+    bestMove, err := search.Wait()
+    assert.Nil(t, err)
+    assert.Equal(t, []int{1, 2}, depths)
+    assert.Equal(t, &BestMove{"e2e4", "e7e5"}, bestMove)
+    assert.Equal(t, UCI_READY, client.State())
+}
+
+func TestUciClient_analyze_02(t *testing.T) {
+    // an infinite search is stopped by the context
+    client, _ := newFakeClient(t)
+    ctx, cancel := context.WithCancel(context.Background())
+    search, err := client.Analyze(ctx, Position{}, Limits{})
+    assert.Nil(t, err)
+    assert.Equal(t, UCI_SEARCHING, client.State())
+
+    _, err = client.Analyze(context.Background(), Position{}, Limits{})
+    assert.NotNil(t, err)
+
+    <-search.Info
+    cancel()
+    for range search.Info {
+    }
+    bestMove, err := search.Wait()
+    assert.Nil(t, err)
+    assert.Equal(t, "d2d4", bestMove.Move)
+    assert.Equal(t, UCI_READY, client.State())
+}
+
+func TestUciClient_closed_01(t *testing.T) {
+    client, input := newFakeClient(t)
+    ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+    defer cancel()
+    search, err := client.Analyze(ctx, Position{}, Limits{Infinite: true})
+    assert.Nil(t, err)
+    <-search.Info
+    <-search.Info
+    input <- "quit"
+
+    _, err = search.Wait()
+    assert.Equal(t, ErrEngineClosed, err)
+    assert.Equal(t, UCI_CLOSED, client.State())
+    assert.Equal(t, ErrEngineClosed, client.IsReady(ctx))
+}
+
+func TestUciCommands_01(t *testing.T) {
+    assert.Equal(t, "position startpos", Position{}.Command())
+    assert.Equal(t, "position fen 4k3/8/8/8/8/8/8/4K3 w - - 0 1 moves e1e2",
+        Position{"4k3/8/8/8/8/8/8/4K3 w - - 0 1", []string{"e1e2"}}.Command())
+
+    assert.Equal(t, "go infinite", Limits{}.Command())
+    assert.Equal(t, "go depth 20", Limits{Depth: 20}.Command())
+    assert.Equal(t, "go searchmoves e2e4 d2d4 movetime 1500", Limits{MoveTime: 1500 * time.Millisecond, SearchMoves: []string{"e2e4", "d2d4"}}.Command())
+    assert.Equal(t, "go ponder wtime 60000 btime 50000 winc 1000 binc 1000", Limits{Ponder: true, WTime: time.Minute, BTime: 50 * time.Second, WInc: time.Second, BInc: time.Second}.Command())
+}
@@ -75,6 +75,7 @@ func TestPrettyLine_unique_02(t *testing.T) {
     board := NewBitBoard(fen)
     uci_line := "a6c6 h2h4 c6a6 h4h2 e8c6 g6f4 c6e8 f4g6"
     res := PrettyLine(uci_line, board, 1, true)
+    // the third repetition of the start position only allows a claim, the line gets no result
     assert.Equal(t, "1.Qa6c6 R2h4 2.Qca6 Rh2 3.Qe8c6 N6f4 4.Qce8 Ng6", res)
 }
 
@@ -84,7 +85,7 @@ func TestPrettyLine_mate_01(t *testing.T) {
     board := NewBitBoard(fen)
     uci_line := "f6h5 g6f7 e6f6 f7g8 e5e8"
     res := PrettyLine(uci_line, board, 1, true)
-    assert.Equal(t, "1.Nh5+ Kf7 2.Rf6+ Kg8 3.Re8+", res)  // TODO: need to implement mate
+    assert.Equal(t, "1.Nh5+ Kf7 2.Rf6+ Kg8 3.Re8# 1-0", res)
 }
 
 func TestPrintMainline_01(t *testing.T) {
@@ -92,5 +93,25 @@ func TestPrintMainline_01(t *testing.T) {
     uci := "info depth 11 seldepth 8 multipv 1 score mate 3 nodes 2530 nps 253000 tbhits 0 time 10 pv f6h5 g6f7 e6f6 f7g8 e5e8"
     as := NewAnalysisState(fenString)
     res := printMainline(uci, as)
-    assert.Equal(t, "#3 - 1.Nh5+ Kf7 2.Rf6+ Kg8 3.Re8+", res)  // TODO: need to implement mate
+    assert.Equal(t, "#3 - 1.Nh5+ Kf7 2.Rf6+ Kg8 3.Re8# 1-0", res)
+}
+
+func TestPrettyLine_board_unchanged(t *testing.T) {
+    board := NewBitBoardStart()
+    PrettyLine("e2e4 e7e5 g1f3", board, 1, true)
+    assert.Equal(t, STARTPOSITION, board.FEN())
+}
+
+func TestPrettyLine_stalemate_01(t *testing.T) {
+    fenString := "7k/8/5K2/6Q1/8/8/8/8 w - - 0 1"
+    board := NewBitBoard(NewFen(fenString))
+    res := PrettyLine("g5g6", board, 1, true)
+    assert.Equal(t, "1.Qg6 1/2-1/2", res)
+}
+
+func TestPrettyLine_mate_02(t *testing.T) {
+    // fool's mate
+    board := NewBitBoardStart()
+    res := PrettyLine("f2f3 e7e5 g2g4 d8h4", board, 1, true)
+    assert.Equal(t, "1.f3 e5 2.g4 Qh4# 0-1", res)
 }